@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"greenlight.vysotsky.com/internal/data"
+)
+
+type contextKey string
+
+const (
+	userContextKey        = contextKey("user")
+	loggingInfoContextKey = contextKey("loggingInfo")
+	routeInfoContextKey   = contextKey("routeInfo")
+)
+
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// should only be called for requests that went through the authenticate middleware
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+	return user
+}
+
+// inner middleware fill the shared LoggingInfo in, e.g. with the user id
+func (app *application) contextSetLoggingInfo(r *http.Request, info *LoggingInfo) *http.Request {
+	ctx := context.WithValue(r.Context(), loggingInfoContextKey, info)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetLoggingInfo(r *http.Request) *LoggingInfo {
+	info, _ := r.Context().Value(loggingInfoContextKey).(*LoggingInfo)
+	return info
+}
+
+func (app *application) contextSetRouteInfo(r *http.Request, route *routeInfo) *http.Request {
+	ctx := context.WithValue(r.Context(), routeInfoContextKey, route)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetRouteInfo(r *http.Request) *routeInfo {
+	route, _ := r.Context().Value(routeInfoContextKey).(*routeInfo)
+	return route
+}
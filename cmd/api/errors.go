@@ -1,12 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+
+	"greenlight.vysotsky.com/internal/jsonpatch"
 )
 
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.PrintFatal(err, map[string]string{
+	app.logger.PrintError(err.Error(), map[string]string{
 		"request_method": r.Method,
 		"request_url": r.URL.String(),
 	})
@@ -53,4 +56,54 @@ func (app *application) ErrEditConflictResponse(w http.ResponseWriter, r *http.R
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
-}
\ No newline at end of file
+}
+
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource was modified since you last fetched it, fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-Patch", "application/json, application/merge-patch+json, application/json-patch+json")
+	message := fmt.Sprintf("the %q media type is not supported for this resource", r.Header.Get("Content-Type"))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+func (app *application) patchErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, jsonpatch.ErrMalformedPatch):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		app.errorResponse(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, jsonpatch.ErrInvalidOperation):
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, err.Error())
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
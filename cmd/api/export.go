@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"greenlight.vysotsky.com/internal/data"
+	"greenlight.vysotsky.com/internal/validator"
+)
+
+const (
+	// rows written between flushes
+	exportFlushRows = 500
+	// every flush gives the client this long to read the next chunk, the
+	// server's WriteTimeout would otherwise cut long exports short
+	exportWriteTimeout = 30 * time.Second
+)
+
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	params := r.URL.Query()
+	filters := app.readMovieFilters(params, v)
+	format := app.readString(params, "format", "ndjson")
+	v.Check(validator.In(format, "ndjson", "csv", "json"), "format", "must be one of ndjson, csv or json")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	bw := bufio.NewWriter(w)
+
+	var enc movieEncoder
+	switch format {
+	case "csv":
+		enc = &csvMovieEncoder{w: csv.NewWriter(bw)}
+	case "json":
+		enc = &jsonMovieEncoder{w: bw}
+	default:
+		enc = &ndjsonMovieEncoder{w: bw}
+	}
+
+	flush := func() error {
+		err := bw.Flush()
+		if err != nil {
+			return err
+		}
+		err = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	// headers are only sent with the first row, until then a failed query can
+	// still get a proper error response
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", enc.ContentType())
+		w.Header().Set("Content-Disposition", `attachment; filename="movies.`+format+`"`)
+		w.WriteHeader(http.StatusOK)
+		return enc.Begin()
+	}
+
+	rows := 0
+	err := app.models.Movies.Export(r.Context(), filters, func(movie *data.Movie) error {
+		if !started {
+			err := start()
+			if err != nil {
+				return err
+			}
+		}
+
+		err := enc.Encode(movie)
+		if err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushRows == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = enc.End()
+	}
+	if err == nil {
+		err = flush()
+	}
+
+	if err != nil {
+		switch {
+		case !started:
+			app.serverErrorResponse(w, r, err)
+		case errors.Is(err, context.Canceled):
+			// the client went away
+		default:
+			// the status is already sent, all that can be done is to log it
+			app.logger.PrintError(err.Error(), map[string]string{
+				"request_method": r.Method,
+				"request_url":    r.URL.String(),
+				"rows":           strconv.Itoa(rows),
+			})
+		}
+	}
+}
+
+type movieEncoder interface {
+	ContentType() string
+	Begin() error
+	Encode(movie *data.Movie) error
+	End() error
+}
+
+// ndjsonMovieEncoder writes one movie per line, the same as the API shows them
+type ndjsonMovieEncoder struct {
+	w *bufio.Writer
+}
+
+func (e *ndjsonMovieEncoder) ContentType() string { return "application/x-ndjson" }
+
+func (e *ndjsonMovieEncoder) Begin() error { return nil }
+
+func (e *ndjsonMovieEncoder) Encode(movie *data.Movie) error {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+	e.w.Write(js)
+	return e.w.WriteByte('\n')
+}
+
+func (e *ndjsonMovieEncoder) End() error { return nil }
+
+// jsonMovieEncoder writes a single JSON array
+type jsonMovieEncoder struct {
+	w     *bufio.Writer
+	comma bool
+}
+
+func (e *jsonMovieEncoder) ContentType() string { return "application/json" }
+
+func (e *jsonMovieEncoder) Begin() error {
+	return e.w.WriteByte('[')
+}
+
+func (e *jsonMovieEncoder) Encode(movie *data.Movie) error {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+	if e.comma {
+		e.w.WriteByte(',')
+	}
+	e.comma = true
+	e.w.WriteByte('\n')
+	_, err = e.w.Write(js)
+	return err
+}
+
+func (e *jsonMovieEncoder) End() error {
+	_, err := e.w.WriteString("\n]\n")
+	return err
+}
+
+// csvMovieEncoder writes runtime in minutes and genres separated by "|"
+type csvMovieEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvMovieEncoder) ContentType() string { return "text/csv; charset=utf-8" }
+
+func (e *csvMovieEncoder) Begin() error {
+	return e.write([]string{"id", "title", "year", "runtime", "genres", "version"})
+}
+
+func (e *csvMovieEncoder) Encode(movie *data.Movie) error {
+	return e.write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.Title,
+		strconv.FormatInt(int64(movie.Year), 10),
+		strconv.FormatInt(int64(movie.Runtime), 10),
+		strings.Join(movie.Genres, "|"),
+		strconv.FormatInt(int64(movie.Version), 10),
+	})
+}
+
+func (e *csvMovieEncoder) End() error { return nil }
+
+// write passes the record straight through, csv.Writer has its own buffer
+// which periodic flushes of the response wouldn't reach otherwise
+func (e *csvMovieEncoder) write(record []string) error {
+	err := e.w.Write(record)
+	if err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight.vysotsky.com/internal/data"
+	"greenlight.vysotsky.com/internal/jsonlog"
+	"greenlight.vysotsky.com/internal/sqlstub"
+)
+
+// exportRows are the movies the export cursor returns, the second title needs
+// quoting in csv and escaping in json
+var exportRows = [][]driver.Value{
+	{int64(1), time.Unix(0, 0), "Moana", int64(2016), int64(107), []byte(`{animation,adventure}`), int64(1)},
+	{int64(2), time.Unix(0, 0), `Crouching Tiger, "Hidden" Dragon`, int64(2000), int64(120), []byte(`{action}`), int64(3)},
+}
+
+func TestExportMoviesHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		format          string
+		rows            [][]driver.Value
+		wantContentType string
+		want            string
+	}{
+		{
+			name:            "ndjson",
+			format:          "ndjson",
+			rows:            exportRows,
+			wantContentType: "application/x-ndjson",
+			want: `{"id":1,"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation","adventure"],"version":1}
+{"id":2,"title":"Crouching Tiger, \"Hidden\" Dragon","year":2000,"runtime":"120 mins","genres":["action"],"version":3}
+`,
+		},
+		{
+			name:            "ndjson without movies",
+			format:          "ndjson",
+			wantContentType: "application/x-ndjson",
+			want:            "",
+		},
+		{
+			// runtime is a plain number of minutes, so the file can be imported again
+			name:            "csv",
+			format:          "csv",
+			rows:            exportRows,
+			wantContentType: "text/csv; charset=utf-8",
+			want: `id,title,year,runtime,genres,version
+1,Moana,2016,107,animation|adventure,1
+2,"Crouching Tiger, ""Hidden"" Dragon",2000,120,action,3
+`,
+		},
+		{
+			name:            "csv without movies",
+			format:          "csv",
+			wantContentType: "text/csv; charset=utf-8",
+			want:            "id,title,year,runtime,genres,version\n",
+		},
+		{
+			name:            "json",
+			format:          "json",
+			rows:            exportRows,
+			wantContentType: "application/json",
+			want: `[
+{"id":1,"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation","adventure"],"version":1},
+{"id":2,"title":"Crouching Tiger, \"Hidden\" Dragon","year":2000,"runtime":"120 mins","genres":["action"],"version":3}
+]
+`,
+		},
+		{
+			name:            "json without movies",
+			format:          "json",
+			wantContentType: "application/json",
+			want:            "[\n]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sqlstub.Open(func(query string, args []driver.NamedValue) sqlstub.Result {
+				if !strings.Contains(query, "FETCH FORWARD") {
+					return sqlstub.Result{}
+				}
+				return sqlstub.Result{Columns: make([]string, 7), Rows: tt.rows}
+			})
+			defer db.Close()
+
+			app := &application{
+				logger: jsonlog.New(io.Discard, jsonlog.LevelInfo),
+				models: data.NewModels(db.DB),
+			}
+
+			w := httptest.NewRecorder()
+			app.exportMoviesHandler(w, httptest.NewRequest(http.MethodGet, "/v1/movies/export?format="+tt.format, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("got content type %q, want %q", got, tt.wantContentType)
+			}
+			if got, want := w.Header().Get("Content-Disposition"), `attachment; filename="movies.`+tt.format+`"`; got != want {
+				t.Errorf("got content disposition %q, want %q", got, want)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("got body:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,12 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"greenlight.vysotsky.com/internal/data"
 	"greenlight.vysotsky.com/internal/validator"
 )
 
@@ -23,6 +26,15 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+func (app *application) readVersionParam(r *http.Request) (int32, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	version, err := strconv.ParseInt(params.ByName("version"), 10, 32)
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version parameter")
+	}
+	return int32(version), nil
+}
+
 type envelope map[string]interface {}
 
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
@@ -94,6 +106,21 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dist in
 	return nil
 }
 
+// requestMediaType returns the media type of the body, without parameters.
+// A missing Content-Type is treated as JSON, as clients never had to send it.
+func requestMediaType(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return "application/json"
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
 func (app *application) readString(params url.Values, key string, defaultValue string) string {
 	s := params.Get(key)
 	if s == "" {
@@ -124,3 +151,107 @@ func (app *application) readInt(params url.Values, key string, defaultValue int,
 	return i
 }
 
+func (app *application) readBool(params url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := params.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+// readTime parses an RFC 3339 timestamp, the zero time means it wasn't given
+func (app *application) readTime(params url.Values, key string, v *validator.Validator) time.Time {
+	s := params.Get(key)
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 timestamp")
+		return time.Time{}
+	}
+	return t
+}
+
+// readMovieFilters reads the filters shared by the movie listing endpoints
+// and validates them
+func (app *application) readMovieFilters(params url.Values, v *validator.Validator) data.MovieFilters {
+	f := data.MovieFilters{
+		Title:         app.readString(params, "title", ""),
+		Fuzzy:         app.readBool(params, "fuzzy", false, v),
+		Genres:        app.readCSV(params, "genres", []string{}),
+		GenresMode:    app.readString(params, "genres_mode", data.GenresModeAll),
+		ExcludeGenres: app.readCSV(params, "exclude_genres", []string{}),
+		YearMin:       app.readInt(params, "year_min", 0, v),
+		YearMax:       app.readInt(params, "year_max", 0, v),
+		RuntimeMin:    app.readInt(params, "runtime_min", 0, v),
+		RuntimeMax:    app.readInt(params, "runtime_max", 0, v),
+		CreatedAfter:  app.readTime(params, "created_after", v),
+		CreatedBefore: app.readTime(params, "created_before", v),
+	}
+	data.ValidateMovieFilters(v, f)
+	return f
+}
+
+// movieETag is a strong validator, a movie's representation only changes
+// together with its version
+func movieETag(movie *data.Movie) string {
+	return fmt.Sprintf(`"%d-%d"`, movie.ID, movie.Version)
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag.
+// If-Match uses strong comparison, so weak validators never match it.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// versionFromETag finds the movie version in an If-Match header, the header
+// must name exactly one etag of the movie
+func versionFromETag(header string, id int64) (int32, bool) {
+	var version int32
+	found := 0
+	for _, candidate := range strings.Split(header, ",") {
+		var etagID int64
+		var etagVersion int32
+		_, err := fmt.Sscanf(strings.TrimSpace(candidate), `"%d-%d"`, &etagID, &etagVersion)
+		if err == nil && etagID == id {
+			version = etagVersion
+			found++
+		}
+	}
+	return version, found == 1
+}
+
+// background runs fn in a goroutine which graceful shutdown waits for
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Sprintf("%s", err), nil)
+			}
+		}()
+
+		fn()
+	}()
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"greenlight.vysotsky.com/internal/data"
+	"greenlight.vysotsky.com/internal/validator"
+)
+
+const (
+	importMaxBytes  = 32 << 20
+	importBatchSize = 500
+	// a broken file shouldn't produce a megabyte of errors
+	importMaxErrors = 1000
+	// the server's read and write timeouts are meant for small requests, a file
+	// of importMaxBytes takes longer to upload and insert on a slow connection
+	importTimeout = 5 * time.Minute
+)
+
+type importRowError struct {
+	Line   int               `json:"line"`
+	Errors map[string]string `json:"errors"`
+}
+
+type importReport struct {
+	DryRun          bool             `json:"dry_run"`
+	Atomic          bool             `json:"atomic"`
+	Rows            int              `json:"rows"`
+	Valid           int              `json:"valid"`
+	Created         []int64          `json:"created"`
+	Errors          []importRowError `json:"errors"`
+	ErrorsTruncated bool             `json:"errors_truncated,omitempty"`
+}
+
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	params := r.URL.Query()
+	dryRun := app.readBool(params, "dry_run", false, v)
+	atomic := app.readBool(params, "atomic", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(importTimeout)
+	err := rc.SetReadDeadline(deadline)
+	if err == nil {
+		err = rc.SetWriteDeadline(deadline)
+	}
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, importMaxBytes)
+
+	var rows movieRowReader
+	switch requestMediaType(r) {
+	case "text/csv":
+		csvRows, err := newCSVMovieReader(body)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		rows = csvRows
+	case "application/x-ndjson":
+		rows = newNDJSONMovieReader(body)
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	importer := &movieImporter{
+		ctx:    r.Context(),
+		models: app.models,
+		userID: app.contextGetUser(r).ID,
+		report: importReport{
+			DryRun:  dryRun,
+			Atomic:  atomic,
+			Created: []int64{},
+			Errors:  []importRowError{},
+		},
+	}
+
+	for {
+		movie, line, rowErrors, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// the rest of the body can't be read, report it like a bad row
+			importer.addError(line, map[string]string{"body": err.Error()})
+			break
+		}
+
+		importer.report.Rows++
+		if rowErrors == nil {
+			v := validator.New()
+			if data.ValidateMovie(v, movie); !v.Valid() {
+				rowErrors = v.Errors
+			}
+		}
+		if rowErrors != nil {
+			importer.addError(line, rowErrors)
+			continue
+		}
+
+		importer.report.Valid++
+		err = importer.add(movie)
+		if err != nil {
+			importer.abort()
+			app.importFailedResponse(w, r, importer.report, err)
+			return
+		}
+	}
+
+	err = importer.finish()
+	if err != nil {
+		app.importFailedResponse(w, r, importer.report, err)
+		return
+	}
+
+	status := http.StatusOK
+	if atomic && len(importer.report.Errors) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	err = app.writeJSON(w, status, envelope{"import": importer.report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// importFailedResponse reports a server error part way through an import.
+// Batches committed before it stay in the database, so the report listing
+// them is sent along with the error.
+func (app *application) importFailedResponse(w http.ResponseWriter, r *http.Request, report importReport, err error) {
+	app.logError(r, err)
+	env := envelope{
+		"error":  "server could not finish the import, only the movies listed as created were imported",
+		"import": report,
+	}
+	err = app.writeJSON(w, http.StatusInternalServerError, env, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// movieImporter inserts valid rows in batches. Without atomic every batch is
+// committed on its own, with it everything is committed at the end and only
+// if there were no invalid rows.
+type movieImporter struct {
+	// the request context, transactions are rolled back when it's done
+	ctx    context.Context
+	models data.Models
+	userID int64
+	report importReport
+
+	batch   []*data.Movie
+	current *data.MovieImport
+	pending []int64
+}
+
+func (imp *movieImporter) addError(line int, errs map[string]string) {
+	if len(imp.report.Errors) >= importMaxErrors {
+		imp.report.ErrorsTruncated = true
+		return
+	}
+	imp.report.Errors = append(imp.report.Errors, importRowError{Line: line, Errors: errs})
+}
+
+func (imp *movieImporter) add(movie *data.Movie) error {
+	imp.batch = append(imp.batch, movie)
+	if len(imp.batch) < importBatchSize {
+		return nil
+	}
+	return imp.flush()
+}
+
+func (imp *movieImporter) flush() error {
+	batch := imp.batch
+	imp.batch = nil
+
+	// nothing will be committed, don't bother the database
+	if len(batch) == 0 || imp.report.DryRun || (imp.report.Atomic && len(imp.report.Errors) > 0) {
+		return nil
+	}
+
+	tx := imp.current
+	if tx == nil {
+		var err error
+		tx, err = imp.models.Movies.BeginImport(imp.ctx, imp.userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := tx.Insert(batch)
+	if err != nil {
+		tx.Rollback()
+		imp.current = nil
+		imp.pending = nil
+		return err
+	}
+	for _, movie := range batch {
+		imp.pending = append(imp.pending, movie.ID)
+	}
+
+	if imp.report.Atomic {
+		imp.current = tx
+		return nil
+	}
+	return imp.commit(tx)
+}
+
+func (imp *movieImporter) commit(tx *data.MovieImport) error {
+	err := tx.Commit()
+	if err != nil {
+		return err
+	}
+	imp.report.Created = append(imp.report.Created, imp.pending...)
+	imp.pending = nil
+	return nil
+}
+
+func (imp *movieImporter) finish() error {
+	err := imp.flush()
+	if err != nil || imp.current == nil {
+		return err
+	}
+
+	tx := imp.current
+	imp.current = nil
+	if len(imp.report.Errors) > 0 {
+		imp.pending = nil
+		return tx.Rollback()
+	}
+	return imp.commit(tx)
+}
+
+// abort rolls back whatever isn't committed yet, those movies aren't created
+func (imp *movieImporter) abort() {
+	if imp.current != nil {
+		imp.current.Rollback()
+		imp.current = nil
+	}
+	imp.pending = nil
+}
+
+// movieRowReader returns parsed rows one at a time. Problems with a single
+// row are returned as row errors, err is only set when reading can't go on.
+type movieRowReader interface {
+	Next() (movie *data.Movie, line int, rowErrors map[string]string, err error)
+}
+
+// csvMovieReader reads a header row followed by one movie per record,
+// runtime is in minutes and genres are separated by "|"
+type csvMovieReader struct {
+	r       *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+var csvMovieColumns = []string{"title", "year", "runtime", "genres"}
+
+func newCSVMovieReader(body io.Reader) (*csvMovieReader, error) {
+	r := csv.NewReader(body)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, fmt.Errorf("invalid csv header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.In(name, csvMovieColumns...) {
+			return nil, fmt.Errorf("csv header contains unknown column %q", name)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("csv header contains duplicate column %q", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range csvMovieColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv header must contain the %q column", name)
+		}
+	}
+
+	return &csvMovieReader{r: r, columns: columns}, nil
+}
+
+func (c *csvMovieReader) Next() (*data.Movie, int, map[string]string, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			c.line = parseError.Line
+			return nil, parseError.StartLine, map[string]string{"row": parseError.Err.Error()}, nil
+		}
+		// the position isn't known after a read error, the next line is close enough
+		return nil, c.line + 1, nil, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	c.line = line
+	if len(record) != len(c.columns) {
+		return nil, line, map[string]string{"row": fmt.Sprintf("must have %d fields", len(c.columns))}, nil
+	}
+
+	rowErrors := make(map[string]string)
+	movie := &data.Movie{
+		Title:  record[c.columns["title"]],
+		Genres: []string{},
+	}
+
+	year, err := strconv.ParseInt(strings.TrimSpace(record[c.columns["year"]]), 10, 32)
+	if err != nil {
+		rowErrors["year"] = "must be an integer value"
+	}
+	movie.Year = int32(year)
+
+	runtime, err := strconv.ParseInt(strings.TrimSpace(record[c.columns["runtime"]]), 10, 32)
+	if err != nil {
+		rowErrors["runtime"] = "must be an integer number of minutes"
+	}
+	movie.Runtime = data.Runtime(runtime)
+
+	for _, genre := range strings.Split(record[c.columns["genres"]], "|") {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			movie.Genres = append(movie.Genres, genre)
+		}
+	}
+
+	if len(rowErrors) > 0 {
+		return nil, line, rowErrors, nil
+	}
+	return movie, line, nil, nil
+}
+
+// ndjsonMovieReader reads one JSON movie per line, in the same format
+// POST /v1/movies accepts
+type ndjsonMovieReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newNDJSONMovieReader(body io.Reader) *ndjsonMovieReader {
+	s := bufio.NewScanner(body)
+	s.Buffer(make([]byte, 0, 64*1024), 1_048_576)
+	return &ndjsonMovieReader{s: s}
+}
+
+func (n *ndjsonMovieReader) Next() (*data.Movie, int, map[string]string, error) {
+	for n.s.Scan() {
+		n.line++
+
+		line := bytes.TrimSpace(n.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var input struct {
+			Title   string       `json:"title"`
+			Year    int32        `json:"year"`
+			Runtime data.Runtime `json:"runtime"`
+			Genres  []string     `json:"genres"`
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&input)
+		if err == nil && dec.More() {
+			err = errors.New("line must only contain a single JSON value")
+		}
+		if err != nil {
+			return nil, n.line, map[string]string{"row": err.Error()}, nil
+		}
+
+		movie := &data.Movie{
+			Title:   input.Title,
+			Year:    input.Year,
+			Runtime: input.Runtime,
+			Genres:  input.Genres,
+		}
+		return movie, n.line, nil, nil
+	}
+
+	if err := n.s.Err(); err != nil {
+		return nil, n.line + 1, nil, err
+	}
+	return nil, n.line, nil, io.EOF
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.vysotsky.com/internal/data"
+	"greenlight.vysotsky.com/internal/jsonlog"
+	"greenlight.vysotsky.com/internal/sqlstub"
+)
+
+// TestImportMoviesHandlerPartialFailure checks that a database error in a
+// later batch still reports the movies committed by the earlier ones
+func TestImportMoviesHandlerPartialFailure(t *testing.T) {
+	inserts := 0
+	db := sqlstub.Open(func(query string, args []driver.NamedValue) sqlstub.Result {
+		if !strings.Contains(query, "INSERT INTO movies") {
+			return sqlstub.Result{}
+		}
+		inserts++
+		if inserts > 1 {
+			return sqlstub.Result{Err: errors.New("connection reset")}
+		}
+
+		// the first argument holds the titles, ids start at 1
+		titles := *args[0].Value.(*pq.StringArray)
+		result := sqlstub.Result{Columns: []string{"n", "id", "created_at", "version"}}
+		for i := range titles {
+			result.Rows = append(result.Rows, []driver.Value{int64(i + 1), int64(i + 1), time.Now(), int64(1)})
+		}
+		return result
+	})
+	defer db.Close()
+
+	app := &application{
+		logger: jsonlog.New(io.Discard, jsonlog.LevelInfo),
+		models: data.NewModels(db.DB),
+	}
+
+	var body strings.Builder
+	body.WriteString("title,year,runtime,genres\n")
+	for i := 0; i < importBatchSize+1; i++ {
+		fmt.Fprintf(&body, "Movie %d,2000,90,drama\n", i)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies/import", strings.NewReader(body.String()))
+	r.Header.Set("Content-Type", "text/csv")
+	r = app.contextSetUser(r, &data.User{ID: 7})
+	w := httptest.NewRecorder()
+	app.importMoviesHandler(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	var response struct {
+		Error  string       `json:"error"`
+		Import importReport `json:"import"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Error == "" {
+		t.Error("missing error message")
+	}
+	if got := len(response.Import.Created); got != importBatchSize {
+		t.Errorf("got %d created movies, want %d", got, importBatchSize)
+	}
+}
+
+// deadlineRecorder records the deadlines set through http.ResponseController
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	read, write time.Time
+}
+
+func (d *deadlineRecorder) SetReadDeadline(t time.Time) error {
+	d.read = t
+	return nil
+}
+
+func (d *deadlineRecorder) SetWriteDeadline(t time.Time) error {
+	d.write = t
+	return nil
+}
+
+func TestImportMoviesHandlerDeadlines(t *testing.T) {
+	app := &application{
+		logger: jsonlog.New(io.Discard, jsonlog.LevelInfo),
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies/import?dry_run=true", strings.NewReader("title,year,runtime,genres\nUp,2009,96,animation\n"))
+	r.Header.Set("Content-Type", "text/csv")
+	r = app.contextSetUser(r, &data.User{ID: 7})
+	w := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+	app.importMoviesHandler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	// the server's 10 second read timeout is far too short for importMaxBytes
+	for name, deadline := range map[string]time.Time{"read": w.read, "write": w.write} {
+		if until := time.Until(deadline); until < importTimeout-time.Minute {
+			t.Errorf("got %s deadline in %v, want about %v", name, until, importTimeout)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// purgeTrash permanently deletes movies which stayed in the trash for longer
+// than the retention period. It runs until ctx is cancelled.
+func (app *application) purgeTrash(ctx context.Context) {
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		purged, err := app.models.Movies.PurgeDeletedBefore(time.Now().Add(-app.config.trash.retention))
+		if err != nil {
+			app.logger.PrintError(err.Error(), map[string]string{
+				"task": "purge trash",
+			})
+			continue
+		}
+
+		if purged > 0 {
+			app.logger.PrintInfo("purged movies from trash", map[string]string{
+				"count": strconv.FormatInt(purged, 10),
+			})
+		}
+	}
+}
@@ -2,16 +2,23 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofor-little/env"
 	_ "github.com/lib/pq"
+	"greenlight.vysotsky.com/internal/cache"
 	"greenlight.vysotsky.com/internal/data"
 	"greenlight.vysotsky.com/internal/jsonlog"
+	"greenlight.vysotsky.com/internal/mailer"
+	"greenlight.vysotsky.com/internal/migrate"
+	"greenlight.vysotsky.com/migrations"
 )
 
 const version = "1.0.0"
@@ -19,6 +26,9 @@ const version = "1.0.0"
 type config struct {
 	port int
 	env  string
+	metrics struct {
+		addr string
+	}
 	db   struct {
 		dsn          string
 		maxOpenConns int
@@ -30,18 +40,52 @@ type config struct {
 		burst   int
 		enabled bool
 	}
+	suggest struct {
+		rps      float64
+		burst    int
+		cacheTTL time.Duration
+	}
+	stats struct {
+		cacheTTL time.Duration
+	}
+	cursor struct {
+		secret []byte
+	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	cors struct {
+		trustedOrigins []string
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+		dir      string
+	}
 }
 
 type application struct {
 	config config
 	logger *jsonlog.Logger
 	models data.Models
+	mailer mailer.Mailer
+	wg     sync.WaitGroup
+	metrics *appMetrics
+	// recent title suggestions by limit and prefix
+	suggestions *cache.Cache[string, []*data.MovieSuggestion]
+	// catalogue statistics by the cache key of their filters
+	stats *cache.Cache[string, *data.MovieStats]
 }
 
 func main() {
 	var conf config
 	flag.IntVar(&conf.port, "port", 4000, "Api server port")
 	flag.StringVar(&conf.env, "env", "development", "Environment (development|staging|pruduction)")
+	flag.StringVar(&conf.metrics.addr, "metrics-addr", "localhost:4001", "Admin listener address for /metrics, empty to disable")
 
 	if err := env.Load(".env"); err != nil {
 		// panic(err)
@@ -56,15 +100,49 @@ func main() {
 	flag.Float64Var(&conf.limiter.rps, "limiter-rps", 2, "Rate limiter maximium requests per second")
 	flag.IntVar(&conf.limiter.burst, "limiter-burst", 4, "Rate limiter maximium burst")
 	flag.BoolVar(&conf.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Float64Var(&conf.suggest.rps, "suggest-limiter-rps", 10, "Title suggestions rate limiter maximum requests per second")
+	flag.IntVar(&conf.suggest.burst, "suggest-limiter-burst", 20, "Title suggestions rate limiter maximum burst")
+	flag.DurationVar(&conf.suggest.cacheTTL, "suggest-cache-ttl", 30*time.Second, "How long title suggestions are cached, 0 disables the cache")
+	flag.DurationVar(&conf.stats.cacheTTL, "stats-cache-ttl", time.Minute, "How long catalogue statistics are cached, 0 disables the cache")
+
+	flag.StringVar(&conf.smtp.host, "smtp-host", "localhost", "SMTP host")
+	flag.IntVar(&conf.smtp.port, "smtp-port", 25, "SMTP port")
+	flag.StringVar(&conf.smtp.username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&conf.smtp.password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&conf.smtp.sender, "smtp-sender", "Greenlight <no-reply@greenlight.vysotsky.com>", "SMTP sender")
+	flag.StringVar(&conf.smtp.dir, "smtp-dir", "", "Write emails to this directory instead of sending them over SMTP")
+
+	flag.DurationVar(&conf.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies are kept before purging, 0 keeps them forever")
+	flag.DurationVar(&conf.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often deleted movies are purged")
+
+	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
+		conf.cors.trustedOrigins = strings.Fields(val)
+		return nil
+	})
+
+	var cursorSecret string
+	flag.StringVar(&cursorSecret, "cursor-secret", "", "Key for signing pagination cursors, random when empty")
 
 	flag.Parse()
 
+	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+
+	conf.cursor.secret = []byte(cursorSecret)
+	if len(conf.cursor.secret) == 0 {
+		// cursors issued before a restart stop being valid, which is acceptable
+		conf.cursor.secret = make([]byte, 32)
+		_, err := rand.Read(conf.cursor.secret)
+		if err != nil {
+			// an all-zero key would let anyone sign cursors
+			logger.PrintFatal(err, nil)
+		}
+	}
+
 	if len(conf.db.dsn) == 0 {
 		panic("database dsn was not provided neither in .env file nor as a -db-dsn flag")
 	}
 
 	fmt.Println("port:", conf.port)
-	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
 	db, err := openDB(conf)
 	if err != nil {
@@ -75,10 +153,19 @@ func main() {
 
 	logger.PrintInfo("database connection established", nil)
 
+	err = checkSchemaVersion(db)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	app := &application{
 		config: conf,
 		logger: logger,
 		models: data.NewModels(db),
+		mailer: newMailer(conf),
+		metrics: newAppMetrics(db),
+		suggestions: cache.New[string, []*data.MovieSuggestion](conf.suggest.cacheTTL, 10_000),
+		stats: cache.New[string, *data.MovieStats](conf.stats.cacheTTL, 1000),
 	}
 
 	err = app.serve()
@@ -88,6 +175,45 @@ func main() {
 	}
 }
 
+func newMailer(cfg config) mailer.Mailer {
+	if cfg.smtp.dir != "" {
+		return mailer.New(mailer.FileTransport{Dir: cfg.smtp.dir}, cfg.smtp.sender)
+	}
+
+	transport := mailer.SMTPTransport{
+		Host:     cfg.smtp.host,
+		Port:     cfg.smtp.port,
+		Username: cfg.smtp.username,
+		Password: cfg.smtp.password,
+	}
+	return mailer.New(transport, cfg.smtp.sender)
+}
+
+// checkSchemaVersion refuses to work with a database which wasn't migrated
+// to the migrations compiled into the binary
+func checkSchemaVersion(db *sql.DB) error {
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("database schema is dirty at version %d, fix it and run migrate force", version)
+	}
+	if version < m.Latest() {
+		return fmt.Errorf("database schema is at version %d, expected %d, run migrate up", version, m.Latest())
+	}
+
+	return nil
+}
+
 func openDB(cfg config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.db.dsn)
 	if err != nil {
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"greenlight.vysotsky.com/internal/metrics"
+)
+
+type appMetrics struct {
+	registry         *metrics.Registry
+	requests         *metrics.CounterVec
+	duration         *metrics.HistogramVec
+	requestsInFlight atomic.Int64
+}
+
+func newAppMetrics(db *sql.DB) *appMetrics {
+	m := &appMetrics{registry: metrics.NewRegistry()}
+
+	m.requests = m.registry.NewCounterVec("greenlight_http_requests_total",
+		"Number of handled HTTP requests.", "route", "method", "status")
+	m.duration = m.registry.NewHistogramVec("greenlight_http_request_duration_seconds",
+		"Time spent handling HTTP requests.", metrics.DefBuckets, "route", "method", "status")
+	m.registry.NewGaugeFunc("greenlight_http_requests_in_flight", "Number of requests being handled.", func() float64 {
+		return float64(m.requestsInFlight.Load())
+	})
+
+	m.registry.NewGaugeFunc("greenlight_db_max_open_connections", "Maximum number of open connections to the database.", func() float64 {
+		return float64(db.Stats().MaxOpenConnections)
+	})
+	m.registry.NewGaugeFunc("greenlight_db_open_connections", "Number of established connections, both in use and idle.", func() float64 {
+		return float64(db.Stats().OpenConnections)
+	})
+	m.registry.NewGaugeFunc("greenlight_db_in_use_connections", "Number of connections currently in use.", func() float64 {
+		return float64(db.Stats().InUse)
+	})
+	m.registry.NewGaugeFunc("greenlight_db_idle_connections", "Number of idle connections.", func() float64 {
+		return float64(db.Stats().Idle)
+	})
+	m.registry.NewCounterFunc("greenlight_db_wait_count_total", "Number of connections waited for.", func() float64 {
+		return float64(db.Stats().WaitCount)
+	})
+	m.registry.NewCounterFunc("greenlight_db_wait_duration_seconds_total", "Time blocked waiting for a new connection.", func() float64 {
+		return db.Stats().WaitDuration.Seconds()
+	})
+
+	m.registry.RegisterRuntimeMetrics()
+
+	return m
+}
+
+// routeInfo is filled in by tagRoute once the router has matched the request
+type routeInfo struct {
+	pattern string
+}
+
+func (app *application) recordMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		app.metrics.requestsInFlight.Add(1)
+		defer app.metrics.requestsInFlight.Add(-1)
+
+		route := &routeInfo{}
+		r = app.contextSetRouteInfo(r, route)
+
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, r)
+
+		// raw paths would give every movie id its own series
+		pattern := route.pattern
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+
+		method := metricsMethod(r.Method)
+		status := strconv.Itoa(rw.code)
+		app.metrics.requests.Inc(pattern, method, status)
+		app.metrics.duration.Observe(time.Since(start).Seconds(), pattern, method, status)
+	})
+}
+
+// metricsMethod keeps the method label bounded, clients can send any method
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "other"
+	}
+}
+
+func (app *application) tagRoute(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if route := app.contextGetRouteInfo(r); route != nil {
+			route.pattern = pattern
+		}
+		next(w, r)
+	}
+}
@@ -1,47 +1,141 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
+	"greenlight.vysotsky.com/internal/data"
+	"greenlight.vysotsky.com/internal/validator"
 )
 
 type LoggingInfo struct {
-	ipaddr string
-	method string
-	uri string
-	code int
+	requestID string
+	ipaddr    string
+	method    string
+	uri       string
+	userAgent string
+	userID    int64
+	code      int
+	bytes     int
+	duration  time.Duration
 }
 
+// responseWriter remembers what the handler sent so it can be logged afterwards
+type responseWriter struct {
+	http.ResponseWriter
+	code        int
+	bytes       int
+	wroteHeader bool
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{
+		ResponseWriter: w,
+		code:           http.StatusOK,
+	}
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	// informational responses are followed by the real one
+	if !rw.wroteHeader && (code < 100 || code >= 200 || code == http.StatusSwitchingProtocols) {
+		rw.code = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+func (rw *responseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+var requestIDRegexp = regexp.MustCompile(`^[\w\-]{1,64}$`)
+
 func (app *application) logRequests(next http.Handler) http.Handler {
-	fn := func (w http.ResponseWriter, r *http.Request) {
-		defer next.ServeHTTP(w, r)
-
-		info := &LoggingInfo {
-			method: r.Method,
-			uri: r.URL.String(),
-			ipaddr: r.RemoteAddr,
-			}	
-			//if trailing slash redirection is turned on
-			//in order to not log the same request twice we return.
-			path := r.URL.Path
-			if strings.HasSuffix(path, "/") { 
-				return
-			}
-			app.logger.PrintInfo("request", map[string]string{
-				"ip": info.ipaddr,
-				"method": info.method,
-				"uri": info.uri,
-			})
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// keep the id of a proxy in front of us, so log lines can be matched
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDRegexp.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		info := &LoggingInfo{
+			requestID: requestID,
+			ipaddr:    ip,
+			method:    r.Method,
+			uri:       r.URL.RequestURI(),
+			userAgent: r.UserAgent(),
+		}
+		r = app.contextSetLoggingInfo(r, info)
+
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, r)
+
+		info.code = rw.code
+		info.bytes = rw.bytes
+		info.duration = time.Since(start)
+
+		properties := map[string]string{
+			"request_id":  info.requestID,
+			"ip":          info.ipaddr,
+			"method":      info.method,
+			"uri":         info.uri,
+			"user_agent":  info.userAgent,
+			"status":      strconv.Itoa(info.code),
+			"bytes":       strconv.Itoa(info.bytes),
+			"duration_ms": strconv.FormatFloat(float64(info.duration.Microseconds())/1000, 'f', 3, 64),
+		}
+		if info.userID != 0 {
+			properties["user_id"] = strconv.FormatInt(info.userID, 10)
+		}
+		app.logger.PrintInfo("request", properties)
 	}
 	return http.HandlerFunc(fn)
 }
 
+func newRequestID() string {
+	b := make([]byte, 16)
+	// crypto/rand doesn't fail on supported platforms
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -60,6 +154,22 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 		return next
 	}
 
+	limited := app.limitPerIP("greenlight_rate_limiter_clients", app.config.limiter.rps, app.config.limiter.burst, next)
+	// suggestions are requested on every keystroke, they have a limiter of their own
+	suggestLimited := app.limitPerIP("greenlight_suggest_rate_limiter_clients", app.config.suggest.rps, app.config.suggest.burst, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/movies/suggest" {
+			suggestLimited.ServeHTTP(w, r)
+			return
+		}
+		limited.ServeHTTP(w, r)
+	})
+}
+
+// limitPerIP allows each client IP rps requests per second with the given
+// burst. The number of tracked clients is reported under metricName.
+func (app *application) limitPerIP(metricName string, rps float64, burst int, next http.Handler) http.Handler {
 	type client struct {
 		limiter *rate.Limiter
 		lastSeen time.Time
@@ -70,6 +180,12 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 		clients = make(map[string]*client)
 	)
 
+	app.metrics.registry.NewGaugeFunc(metricName, "Number of clients tracked by the rate limiter.", func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return float64(len(clients))
+	})
+
 	go func() {
 		for {
 			time.Sleep(time.Minute)
@@ -95,7 +211,7 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 
 		if _, ok := clients[ip]; !ok {
 			clients[ip] = &client{
-				limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
+				limiter: rate.NewLimiter(rate.Limit(rps), burst),
 			}
 		}
 		client := clients[ip]
@@ -115,4 +231,134 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(fn)
 
-}
\ No newline at end of file
+}
+
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the response depends on the Authorization header, caches must know that
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		token := headerParts[1]
+
+		v := validator.New()
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if info := app.contextGetLoggingInfo(r); info != nil {
+			info.userID = user.ID
+		}
+
+		r = app.contextSetUser(r, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the response differs per origin and per preflight, caches must know that
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+
+		// sandboxed documents and file:// pages all send "null", it identifies nobody
+		if origin != "" && origin != "null" {
+			for _, trusted := range app.config.cors.trustedOrigins {
+				if origin != trusted {
+					continue
+				}
+
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Expose-Headers", "ETag, Location")
+
+				// preflight request
+				if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+					w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, PATCH, DELETE")
+					w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match")
+					w.Header().Set("Access-Control-Max-Age", "60")
+
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				break
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,28 +1,45 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"slices"
+	"strings"
 
 	"greenlight.vysotsky.com/internal/data"
+	"greenlight.vysotsky.com/internal/jsonpatch"
 	"greenlight.vysotsky.com/internal/validator"
 )
 
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title   string
-		Genres  []string
-		Filters data.Filters
+		MovieFilters data.MovieFilters
+		Filters      data.Filters
+		Facets       []string
 	}
 	v := validator.New()
 	params := r.URL.Query()
 	fmt.Println(params)
-	input.Title = app.readString(params, "title", "")
-	input.Genres = app.readCSV(params, "genres", []string{})
+	input.MovieFilters = app.readMovieFilters(params, v)
+	input.Facets = app.readCSV(params, "facets", []string{})
+	data.ValidateFacets(v, input.Facets)
 	input.Filters.Page = app.readInt(params, "page", 1, v)
 	input.Filters.PageSize = app.readInt(params, "page_size", 20, v)
-	input.Filters.Sort = app.readString(params, "sort", "id")
+	// fuzzy matches are only useful best first
+	defaultSort := "id"
+	if input.MovieFilters.Fuzzy && !params.Has("cursor") {
+		defaultSort = "relevance"
+	}
+	input.Filters.Sort = app.readString(params, "sort", defaultSort)
+	// cursor paging is opt-in, an empty cursor parameter asks for the first page
+	input.Filters.CursorMode = params.Has("cursor")
+	input.Filters.Cursor = params.Get("cursor")
+	input.Filters.CursorSecret = app.config.cursor.secret
 	input.Filters.SortSafeList = []string{
 		"id",
 		"-id",
@@ -32,17 +49,32 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 		"-year",
 		"runtime",
 		"-runtime",
+		"relevance",
+	}
+	// a rank isn't a stable position to continue from
+	if slices.Contains(strings.Split(input.Filters.Sort, ","), "relevance") {
+		v.Check(input.MovieFilters.Title != "", "sort", "relevance requires a title search")
+		v.Check(!input.Filters.CursorMode, "sort", "relevance can't be used with cursor paging")
 	}
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(input.MovieFilters, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "movies": movies}, nil)
+	response := envelope{"metadata": metadata, "movies": movies}
+	// facets are opt-in, they cost another pass over the matching movies
+	if len(input.Facets) > 0 {
+		response["facets"], err = app.models.Movies.GetFacets(input.MovieFilters, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = app.writeJSON(w, http.StatusOK, response, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -73,7 +105,17 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, 200, envelope{"movie": movie}, nil)
+	etag := movieETag(movie)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err = app.writeJSON(w, 200, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -83,10 +125,10 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
-		Title   string       `json:title`
-		Year    int32        `json:year`
-		Runtime data.Runtime `json:runtime`
-		Genres  []string     `json:genres`
+		Title   string       `json:"title"`
+		Year    int32        `json:"year"`
+		Runtime data.Runtime `json:"runtime"`
+		Genres  []string     `json:"genres"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -108,13 +150,15 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := app.models.Movies.Insert(movie); err != nil {
+	user := app.contextGetUser(r)
+	if err := app.models.Movies.Insert(movie, user.ID); err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", movieETag(movie))
 
 	if err := app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers); err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -140,19 +184,73 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	//get input from reuqest body
-	var input struct {
-		Title   *string       `json:title`
-		Year    *int32        `json:year`
-		Runtime *data.Runtime `json:runtime`
-		Genres  []string      `json:genres`
+	// the client may only update the version it has seen
+	if match := r.Header.Get("If-Match"); match != "" && !etagMatches(match, movieETag(movie), false) {
+		app.preconditionFailedResponse(w, r)
+		return
 	}
-	err = app.readJSON(w, r, &input)
+
+	//apply the changes from the request body
+	switch mediaType := requestMediaType(r); mediaType {
+	case "application/json":
+		err = app.readMovieUpdate(w, r, movie)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	case mergePatchMediaType, jsonPatchMediaType:
+		err = app.patchMovie(w, r, movie, mediaType)
+		if err != nil {
+			app.patchErrorResponse(w, r, err)
+			return
+		}
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	//validate
+	v := validator.New()
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	//update movie in the database
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.ErrEditConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// readMovieUpdate applies a plain JSON body, only the fields present are changed
+func (app *application) readMovieUpdate(w http.ResponseWriter, r *http.Request, movie *data.Movie) error {
+	var input struct {
+		Title   *string       `json:"title"`
+		Year    *int32        `json:"year"`
+		Runtime *data.Runtime `json:"runtime"`
+		Genres  []string      `json:"genres"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		return err
+	}
+
 	//partial update
 	if input.Title != nil {
 		movie.Title = *input.Title
@@ -167,39 +265,202 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		movie.Genres = input.Genres
 	}
 
-	//validate
+	return nil
+}
+
+const (
+	mergePatchMediaType = "application/merge-patch+json"
+	jsonPatchMediaType  = "application/json-patch+json"
+)
+
+// patchMovie applies a JSON Merge Patch or a JSON Patch to the editable fields
+// of the movie. Unlike a plain JSON body these can clear fields and edit genres.
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request, movie *data.Movie, mediaType string) error {
+	maxBytes := 1_048_576
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return fmt.Errorf("%w: body must not be larger than %d bytes", jsonpatch.ErrMalformedPatch, maxBytes)
+		}
+		return err
+	}
+
+	type movieDocument struct {
+		Title   string       `json:"title"`
+		Year    int32        `json:"year"`
+		Runtime data.Runtime `json:"runtime"`
+		Genres  []string     `json:"genres"`
+	}
+
+	doc, err := json.Marshal(movieDocument{
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  movie.Genres,
+	})
+	if err != nil {
+		return err
+	}
+
+	if mediaType == mergePatchMediaType {
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	} else {
+		doc, err = jsonpatch.Apply(doc, patch)
+	}
+	if err != nil {
+		return err
+	}
+
+	var patched movieDocument
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&patched)
+	if err != nil {
+		return fmt.Errorf("%w: patched movie is invalid: %v", jsonpatch.ErrInvalidOperation, err)
+	}
+
+	movie.Title = patched.Title
+	movie.Year = patched.Year
+	movie.Runtime = patched.Runtime
+	movie.Genres = patched.Genres
+
+	return nil
+}
+
+func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// the version to delete comes either from ?version= or from If-Match,
+	// a mismatch is a 409 in the first case and a 412 in the second
 	v := validator.New()
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	version := app.readInt(r.URL.Query(), "version", 0, v)
+	v.Check(!r.URL.Query().Has("version") || version > 0, "version", "must be greater than 0")
+	v.Check(version <= math.MaxInt32, "version", "must not be greater than 2147483647")
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	//update movie in the database
-	err = app.models.Movies.Update(movie)
+	match := r.Header.Get("If-Match")
+	switch {
+	case version > 0:
+		err = app.models.Movies.DeleteVersion(id, int32(version), app.contextGetUser(r).ID)
+		if errors.Is(err, data.ErrEditConflict) {
+			app.ErrEditConflictResponse(w, r)
+			return
+		}
+
+	case match != "" && strings.TrimSpace(match) != "*":
+		etagVersion, ok := versionFromETag(match, id)
+		if !ok {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+		err = app.models.Movies.DeleteVersion(id, etagVersion, app.contextGetUser(r).ID)
+		if errors.Is(err, data.ErrEditConflict) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+
+	default:
+		err = app.models.Movies.Delete(id, app.contextGetUser(r).ID)
+		// If-Match: * only holds when there is a movie to delete
+		if errors.Is(err, data.ErrRecordNotFound) && strings.TrimSpace(match) == "*" {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+	}
+
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrEditConflict):
-			app.ErrEditConflictResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+func (app *application) listTrashMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+	v := validator.New()
+	params := r.URL.Query()
+	filters.Page = app.readInt(params, "page", 1, v)
+	filters.PageSize = app.readInt(params, "page_size", 20, v)
+	filters.Sort = app.readString(params, "sort", "-deleted_at")
+	filters.SortSafeList = []string{
+		"id",
+		"-id",
+		"title",
+		"-title",
+		"deleted_at",
+		"-deleted_at",
+	}
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetTrash(filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "movies": movies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Restore(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 }
 
-func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) purgeMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
-	err = app.models.Movies.Delete(id)
+
+	err = app.models.Movies.Purge(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -209,7 +470,8 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie permanently deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
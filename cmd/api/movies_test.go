@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.vysotsky.com/internal/data"
+	"greenlight.vysotsky.com/internal/jsonlog"
+	"greenlight.vysotsky.com/internal/sqlstub"
+)
+
+func TestDeleteMovieHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		ifMatch string
+		deleted bool
+		exists  bool
+		want    int
+	}{
+		{name: "deleted", url: "/v1/movies/1", deleted: true, want: http.StatusOK},
+		{name: "not found", url: "/v1/movies/1", want: http.StatusNotFound},
+		{name: "version deleted", url: "/v1/movies/1?version=3", deleted: true, exists: true, want: http.StatusOK},
+		{name: "version not found", url: "/v1/movies/1?version=3", want: http.StatusNotFound},
+		{name: "version conflict", url: "/v1/movies/1?version=3", exists: true, want: http.StatusConflict},
+		{name: "version past int32", url: "/v1/movies/1?version=4294967299", deleted: true, exists: true, want: http.StatusUnprocessableEntity},
+		{name: "if-match deleted", url: "/v1/movies/1", ifMatch: `"1-3"`, deleted: true, exists: true, want: http.StatusOK},
+		{name: "if-match not found", url: "/v1/movies/1", ifMatch: `"1-3"`, want: http.StatusNotFound},
+		{name: "if-match conflict", url: "/v1/movies/1", ifMatch: `"1-3"`, exists: true, want: http.StatusPreconditionFailed},
+		{name: "if-match other movie", url: "/v1/movies/1", ifMatch: `"2-3"`, exists: true, want: http.StatusPreconditionFailed},
+		{name: "if-match any deleted", url: "/v1/movies/1", ifMatch: "*", deleted: true, want: http.StatusOK},
+		// * matches any current movie, without one the precondition fails
+		{name: "if-match any not found", url: "/v1/movies/1", ifMatch: "*", want: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sqlstub.Open(func(query string, args []driver.NamedValue) sqlstub.Result {
+				switch {
+				case strings.Contains(query, "WITH deleted AS"):
+					return sqlstub.Result{
+						Columns: []string{"deleted", "exists"},
+						Rows:    [][]driver.Value{{tt.deleted, tt.exists}},
+					}
+				case strings.Contains(query, "UPDATE movies") && tt.deleted:
+					return sqlstub.Result{RowsAffected: 1}
+				}
+				return sqlstub.Result{}
+			})
+			defer db.Close()
+
+			app := &application{
+				logger: jsonlog.New(io.Discard, jsonlog.LevelInfo),
+				models: data.NewModels(db.DB),
+			}
+			router := httprouter.New()
+			router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.deleteMovieHandler)
+
+			r := httptest.NewRequest(http.MethodDelete, tt.url, nil)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+			r = app.contextSetUser(r, &data.User{ID: 7})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
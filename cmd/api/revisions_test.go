@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.vysotsky.com/internal/data"
+	"greenlight.vysotsky.com/internal/jsonlog"
+	"greenlight.vysotsky.com/internal/sqlstub"
+)
+
+func TestDiffMovieRevisionsHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantField string
+	}{
+		{name: "from missing", query: "to=2", wantField: "from"},
+		{name: "to zero", query: "from=1&to=0", wantField: "to"},
+		// 2^32+1 would be version 1 once cut to int32
+		{name: "from past int32", query: "from=4294967297&to=2", wantField: "from"},
+		{name: "to past int32", query: "from=1&to=2147483648", wantField: "to"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sqlstub.Open(func(query string, args []driver.NamedValue) sqlstub.Result {
+				return sqlstub.Result{}
+			})
+			defer db.Close()
+
+			app := &application{
+				logger: jsonlog.New(io.Discard, jsonlog.LevelInfo),
+				models: data.NewModels(db.DB),
+			}
+			router := httprouter.New()
+			router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/diff", app.diffMovieRevisionsHandler)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/movies/1/revisions/diff?"+tt.query, nil))
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusUnprocessableEntity, w.Body)
+			}
+			var body struct {
+				Error map[string]string `json:"error"`
+			}
+			err := json.Unmarshal(w.Body.Bytes(), &body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body.Error[tt.wantField] == "" {
+				t.Errorf("got errors %v, want one for %s", body.Error, tt.wantField)
+			}
+			if len(db.Queries()) != 0 {
+				t.Errorf("queried the database: %q", db.Queries())
+			}
+		})
+	}
+}
@@ -13,13 +13,54 @@ func (app *application) routes() *httprouter.Router {
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthCheckHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.createMovieHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.listMoviesHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.showMovieHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.updateMovieHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.deleteMovieHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.createUserHandler)
+	// every route is tagged with its pattern for the metrics
+	handle := func(method, pattern string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, pattern, app.tagRoute(pattern, handler))
+	}
+
+	handle(http.MethodGet, "/v1/healthcheck", app.healthCheckHandler)
+	handle(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
+	handle(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
+	handle(http.MethodGet, "/v1/movies/:id", app.dispatchID(app.requirePermission("movies:read", app.showMovieHandler), map[string]http.HandlerFunc{
+		"trash":   app.tagRoute("/v1/movies/trash", app.requirePermission("movies:write", app.listTrashMoviesHandler)),
+		"export":  app.tagRoute("/v1/movies/export", app.requirePermission("movies:read", app.exportMoviesHandler)),
+		"suggest": app.tagRoute("/v1/movies/suggest", app.requirePermission("movies:read", app.suggestMoviesHandler)),
+	}))
+	handle(http.MethodPost, "/v1/movies/:id", app.dispatchID(nil, map[string]http.HandlerFunc{
+		"import": app.tagRoute("/v1/movies/import", app.requirePermission("movies:write", app.importMoviesHandler)),
+	}))
+	handle(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
+	handle(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	handle(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission("movies:write", app.restoreMovieHandler))
+	handle(http.MethodDelete, "/v1/movies/:id/purge", app.requirePermission("movies:purge", app.purgeMovieHandler))
+	handle(http.MethodGet, "/v1/movies/:id/revisions", app.requirePermission("movies:read", app.listMovieRevisionsHandler))
+	handle(http.MethodGet, "/v1/movies/:id/revisions/diff", app.requirePermission("movies:read", app.diffMovieRevisionsHandler))
+	handle(http.MethodPost, "/v1/movies/:id/revisions/:version/restore", app.requirePermission("movies:write", app.restoreMovieRevisionHandler))
+	handle(http.MethodGet, "/v1/stats/movies", app.requirePermission("movies:read", app.movieStatsHandler))
+	handle(http.MethodPost, "/v1/users", app.createUserHandler)
+	handle(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	handle(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	handle(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	handle(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
 
 	return router
-}
\ No newline at end of file
+}
+
+// httprouter doesn't allow static segments like /v1/movies/trash next to
+// /v1/movies/:id, so those are dispatched from the :id route instead.
+// byID may be nil when the method has no :id route of its own.
+func (app *application) dispatchID(byID http.HandlerFunc, static map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := httprouter.ParamsFromContext(r.Context()).ByName("id")
+		if handler, ok := static[name]; ok {
+			handler(w, r)
+			return
+		}
+
+		if byID == nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+		byID(w, r)
+	}
+}
@@ -12,11 +12,17 @@ import (
 	"time"
 )
 
+// how long shutdown waits for background tasks, e.g. emails being sent
+const backgroundTasksTimeout = 30 * time.Second
+
 func (app *application) serve() error {
 	router := app.routes()
-	handler := app.recoverPanic(router)
+	handler := app.authenticate(router)
+	handler = app.recoverPanic(handler)
 	handler = app.rateLimit(handler)
+	handler = app.enableCORS(handler)
 	handler = app.logRequests(handler)
+	handler = app.recordMetrics(handler)
 
 	server := &http.Server {
 		// Addr: fmt.Sprintf(":%d", conf.port),
@@ -27,6 +33,42 @@ func (app *application) serve() error {
 		ReadTimeout: 10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
+	// metrics are served on their own listener, so they aren't exposed with the api
+	var adminServer *http.Server
+	if app.config.metrics.addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", app.metrics.registry.Handler())
+
+		adminServer = &http.Server{
+			Addr:         app.config.metrics.addr,
+			Handler:      mux,
+			ErrorLog:     log.New(app.logger, "", 0),
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			app.logger.PrintInfo("starting admin server", map[string]string{
+				"addr": adminServer.Addr,
+			})
+			err := adminServer.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.PrintError(err.Error(), map[string]string{
+					"addr": adminServer.Addr,
+				})
+			}
+		}()
+	}
+
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	defer stopJanitor()
+	if app.config.trash.retention > 0 && app.config.trash.purgeInterval > 0 {
+		app.background(func() {
+			app.purgeTrash(janitorCtx)
+		})
+	}
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -38,7 +80,35 @@ func (app *application) serve() error {
 		})
 		ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
 		defer cancel()
-		shutdownError <- server.Shutdown(ctx)
+		err := server.Shutdown(ctx)
+		if adminServer != nil {
+			if adminErr := adminServer.Shutdown(ctx); adminErr != nil {
+				app.logger.PrintError(adminErr.Error(), map[string]string{
+					"addr": adminServer.Addr,
+				})
+			}
+		}
+
+		// background tasks are waited for even if the server didn't stop
+		// cleanly, emails being sent mustn't be lost
+		stopJanitor()
+
+		app.logger.PrintInfo("completing background tasks", map[string]string{
+			"addr": server.Addr,
+		})
+
+		done := make(chan struct{})
+		go func() {
+			app.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			shutdownError <- err
+		case <-time.After(backgroundTasksTimeout):
+			shutdownError <- errors.Join(err, errors.New("timed out waiting for background tasks"))
+		}
 	}()
 
 	app.logger.PrintInfo("starting server", map[string]string {
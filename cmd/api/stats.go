@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+
+	"greenlight.vysotsky.com/internal/validator"
+)
+
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	params := r.URL.Query()
+	filters := app.readMovieFilters(params, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	key := filters.CacheKey()
+	stats, ok := app.stats.Get(key)
+	if !ok {
+		var err error
+		stats, err = app.models.Stats.GetMovieStats(filters)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if app.config.stats.cacheTTL > 0 {
+			app.stats.Set(key, stats)
+		}
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
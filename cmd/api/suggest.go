@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"greenlight.vysotsky.com/internal/data"
+	"greenlight.vysotsky.com/internal/validator"
+)
+
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	params := r.URL.Query()
+	prefix := strings.TrimSpace(params.Get("q"))
+	limit := app.readInt(params, "limit", 10, v)
+
+	v.Check(prefix != "", "q", "must be provided")
+	v.Check(utf8.RuneCountInString(prefix) <= 100, "q", "must not be more than 100 characters long")
+	v.Check(limit > 0, "limit", "must be greater than 0")
+	v.Check(limit <= 20, "limit", "maximum value is 20")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	key := strconv.Itoa(limit) + ":" + strings.ToLower(prefix)
+	suggestions, ok := app.suggestions.Get(key)
+	if !ok {
+		var err error
+		suggestions, err = app.models.Movies.Suggest(prefix, limit)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			// suggestions are best effort, the search box shouldn't show an error
+			app.logger.PrintError(err.Error(), map[string]string{
+				"request_url": r.URL.String(),
+			})
+			suggestions = []*data.MovieSuggestion{}
+		case err != nil:
+			app.serverErrorResponse(w, r, err)
+			return
+		case app.config.suggest.cacheTTL > 0:
+			app.suggestions.Set(key, suggestions)
+		}
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.vysotsky.com/internal/cache"
+	"greenlight.vysotsky.com/internal/data"
+	"greenlight.vysotsky.com/internal/jsonlog"
+	"greenlight.vysotsky.com/internal/sqlstub"
+)
+
+// suggestions get a limiter of their own, but still at the global limiter's
+// place in the chain, before authentication reaches the database
+func TestRateLimitSuggest(t *testing.T) {
+	app := &application{
+		logger:  jsonlog.New(io.Discard, jsonlog.LevelInfo),
+		metrics: newAppMetrics(nil),
+	}
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 0.001
+	app.config.limiter.burst = 1
+	app.config.suggest.rps = 0.001
+	app.config.suggest.burst = 2
+
+	handler := app.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	requests := []struct {
+		path string
+		want int
+	}{
+		{path: "/v1/movies/suggest?q=st", want: http.StatusOK},
+		{path: "/v1/movies/suggest?q=sta", want: http.StatusOK},
+		{path: "/v1/movies/suggest?q=star", want: http.StatusTooManyRequests},
+		{path: "/v1/movies", want: http.StatusOK},
+		{path: "/v1/movies", want: http.StatusTooManyRequests},
+	}
+
+	for _, req := range requests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, req.path, nil))
+		if w.Code != req.want {
+			t.Errorf("%s: got status %d, want %d", req.path, w.Code, req.want)
+		}
+	}
+}
+
+func TestSuggestMoviesHandlerTimeout(t *testing.T) {
+	db := sqlstub.Open(func(query string, args []driver.NamedValue) sqlstub.Result {
+		// what lib/pq returns once the context cancels the query
+		time.Sleep(600 * time.Millisecond)
+		return sqlstub.Result{Err: &pq.Error{Code: "57014", Message: "canceling statement due to user request"}}
+	})
+	defer db.Close()
+
+	app := &application{
+		logger:      jsonlog.New(io.Discard, jsonlog.LevelInfo),
+		models:      data.NewModels(db.DB),
+		suggestions: cache.New[string, []*data.MovieSuggestion](time.Minute, 10),
+	}
+	app.config.suggest.cacheTTL = time.Minute
+
+	w := httptest.NewRecorder()
+	app.suggestMoviesHandler(w, httptest.NewRequest(http.MethodGet, "/v1/movies/suggest?q=star", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"suggestions": []`) {
+		t.Errorf("got body %s, want no suggestions", body)
+	}
+	if app.suggestions.Len() != 0 {
+		t.Error("a timed out lookup was cached")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofor-little/env"
+	_ "github.com/lib/pq"
+	"greenlight.vysotsky.com/internal/jsonlog"
+	"greenlight.vysotsky.com/internal/migrate"
+	"greenlight.vysotsky.com/migrations"
+)
+
+const usage = `usage: migrate [flags] <command>
+
+commands:
+  up [N]      apply all or N pending migrations
+  down [N]    revert all or N applied migrations
+  goto V      migrate up or down to version V
+  force V     set version V without running migrations, clears the dirty flag
+  version     print the current version
+
+flags:
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	env.Load(".env")
+	defaultDSN, _ := env.MustGet("DB_DSN")
+
+	var dsn string
+	flag.StringVar(&dsn, "db-dsn", defaultDSN, "PostgreSQL DSN")
+	flag.Parse()
+
+	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+
+	args := flag.Args()
+	if len(args) == 0 || len(args) > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if dsn == "" {
+		logger.PrintFatal(fmt.Errorf("database dsn was not provided neither in .env file nor as a -db-dsn flag"), nil)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// migrations can take a while, but shouldn't hang forever waiting for the lock
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	err = run(ctx, m, args)
+	if err != nil {
+		logger.PrintFatal(err, map[string]string{"command": args[0]})
+	}
+
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	if args[0] == "version" {
+		fmt.Println(formatVersion(version, dirty))
+		return
+	}
+
+	logger.PrintInfo("migrations completed", map[string]string{
+		"command": args[0],
+		"version": formatVersion(version, dirty),
+	})
+}
+
+func run(ctx context.Context, m *migrate.Migrator, args []string) error {
+	switch args[0] {
+	case "up", "down":
+		n := 0
+		if len(args) == 2 {
+			i, err := strconv.Atoi(args[1])
+			if err != nil || i < 1 {
+				return fmt.Errorf("N must be a positive integer")
+			}
+			n = i
+		}
+		if args[0] == "up" {
+			return m.Up(ctx, n)
+		}
+		return m.Down(ctx, n)
+
+	case "goto", "force":
+		if len(args) != 2 {
+			return fmt.Errorf("%s requires a version", args[0])
+		}
+		v, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || v < 0 {
+			return fmt.Errorf("version must be a non-negative integer")
+		}
+		if args[0] == "goto" {
+			return m.Goto(ctx, v)
+		}
+		return m.Force(ctx, v)
+
+	case "version":
+		if len(args) != 1 {
+			return fmt.Errorf("version takes no arguments")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func formatVersion(version int64, dirty bool) string {
+	s := strconv.FormatInt(version, 10)
+	if dirty {
+		s += " (dirty)"
+	}
+	return s
+}
@@ -2,14 +2,13 @@ module greenlight.vysotsky.com
 
 go 1.22.0
 
-require github.com/julienschmidt/httprouter v1.3.0
-
 require (
-	golang.org/x/crypto v0.21.0 // indirect
-	golang.org/x/time v0.5.0 // indirect
+	github.com/julienschmidt/httprouter v1.3.0
+	golang.org/x/crypto v0.21.0
+	golang.org/x/time v0.5.0
 )
 
 require (
 	github.com/gofor-little/env v1.0.16
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/lib/pq v1.10.9
 )
@@ -0,0 +1,95 @@
+package data
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrCursorExpired = errors.New("cursor has expired")
+)
+
+// cursors are for paging through a listing, not for bookmarking a place in it
+const cursorTTL = 24 * time.Hour
+
+// cursor points at a row of a keyset paginated listing. It's signed so
+// clients can't forge keys, but isn't encrypted, nothing in it is secret.
+type cursor struct {
+	Sort string `json:"s"`
+	// values of the row's sort keys, id included
+	Keys     []json.RawMessage `json:"k"`
+	Backward bool              `json:"b,omitempty"`
+	// unix time after which the cursor isn't accepted anymore
+	Expires int64 `json:"x"`
+}
+
+func encodeCursor(secret []byte, c cursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(mac.Sum(nil)), nil
+}
+
+func decodeCursor(secret []byte, token string) (cursor, error) {
+	var c cursor
+
+	payloadPart, signaturePart, ok := strings.Cut(token, ".")
+	if !ok {
+		return c, ErrInvalidCursor
+	}
+
+	enc := base64.RawURLEncoding
+	payload, err := enc.DecodeString(payloadPart)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	signature, err := enc.DecodeString(signaturePart)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return c, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(payload, &c)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if time.Now().Unix() > c.Expires {
+		return c, ErrCursorExpired
+	}
+
+	return c, nil
+}
+
+// keyValues returns the sort keys as query arguments, numbers are kept as
+// json.Number so integer columns compare without float rounding
+func (c cursor) keyValues() ([]interface{}, error) {
+	values := make([]interface{}, len(c.Keys))
+	for i, key := range c.Keys {
+		dec := json.NewDecoder(bytes.NewReader(key))
+		dec.UseNumber()
+
+		err := dec.Decode(&values[i])
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return values, nil
+}
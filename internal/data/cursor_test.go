@@ -0,0 +1,324 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight.vysotsky.com/internal/sqlstub"
+	"greenlight.vysotsky.com/internal/validator"
+)
+
+var testCursorSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func rawKeys(keys ...string) []json.RawMessage {
+	raw := make([]json.RawMessage, len(keys))
+	for i, key := range keys {
+		raw[i] = json.RawMessage(key)
+	}
+	return raw
+}
+
+func TestDecodeCursor(t *testing.T) {
+	valid := cursor{Sort: "-year", Keys: rawKeys("2001", "7"), Expires: time.Now().Add(time.Hour).Unix()}
+	token, err := encodeCursor(testCursorSecret, valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, signature, _ := strings.Cut(token, ".")
+
+	// the same cursor with the sort swapped, signed with the original signature
+	forged, _ := json.Marshal(cursor{Sort: "year", Keys: valid.Keys, Expires: valid.Expires})
+	expired, err := encodeCursor(testCursorSecret, cursor{Sort: "-year", Keys: valid.Keys, Expires: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		token   string
+		wantErr error
+	}{
+		{name: "valid", secret: testCursorSecret, token: token},
+		{name: "tampered payload", secret: testCursorSecret, token: base64.RawURLEncoding.EncodeToString(forged) + "." + signature, wantErr: ErrInvalidCursor},
+		{name: "tampered signature", secret: testCursorSecret, token: payload + "." + base64.RawURLEncoding.EncodeToString([]byte("not a signature")), wantErr: ErrInvalidCursor},
+		{name: "other secret", secret: []byte("another secret"), token: token, wantErr: ErrInvalidCursor},
+		{name: "no signature", secret: testCursorSecret, token: payload, wantErr: ErrInvalidCursor},
+		{name: "not base64", secret: testCursorSecret, token: "!!." + signature, wantErr: ErrInvalidCursor},
+		{name: "empty", secret: testCursorSecret, token: "", wantErr: ErrInvalidCursor},
+		{name: "expired", secret: testCursorSecret, token: expired, wantErr: ErrCursorExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := decodeCursor(tt.secret, tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(c, valid) {
+				t.Errorf("got %+v, want %+v", c, valid)
+			}
+		})
+	}
+}
+
+func TestCursorKeyValues(t *testing.T) {
+	c := cursor{Keys: rawKeys(`"Moana"`, "9007199254740993")}
+
+	values, err := c.keyValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a float64 would round the id to ...992
+	want := []interface{}{"Moana", json.Number("9007199254740993")}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("got %#v, want %#v", values, want)
+	}
+}
+
+func TestValidateFiltersCursor(t *testing.T) {
+	filters := Filters{Page: 1, PageSize: 20, Sort: "-year", SortSafeList: []string{"-year", "title"}, CursorMode: true, CursorSecret: testCursorSecret}
+	issued, err := filters.encodeCursor(cursor{Keys: rawKeys("2001", "7")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := encodeCursor(testCursorSecret, cursor{Sort: "-year", Keys: rawKeys("2001", "7")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+		want   string
+	}{
+		{name: "first page", sort: "-year", cursor: "", want: ""},
+		{name: "issued cursor", sort: "-year", cursor: issued, want: ""},
+		{name: "other sort", sort: "title", cursor: issued, want: "was issued for a different sort value"},
+		{name: "expired", sort: "-year", cursor: expired, want: "has expired"},
+		{name: "garbage", sort: "-year", cursor: "garbage", want: "invalid cursor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := filters
+			f.Sort, f.Cursor = tt.sort, tt.cursor
+
+			v := validator.New()
+			ValidateFilters(v, f)
+			if got := v.Errors["cursor"]; got != tt.want {
+				t.Errorf("got cursor error %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// cursorMovieRows returns rows of the cursor mode listing for the ids, each
+// movie is a year older than the one before so -year sorts like id
+func cursorMovieRows(ids ...int64) sqlstub.Result {
+	result := sqlstub.Result{Columns: make([]string, 9)}
+	for _, id := range ids {
+		result.Rows = append(result.Rows, []driver.Value{
+			id, time.Unix(0, 0), "Movie", 2010 - id, int64(100), []byte("{drama}"), int64(1), nil, nil,
+		})
+	}
+	return result
+}
+
+func TestGetAllByCursor(t *testing.T) {
+	type wantCursor struct {
+		keys     string
+		backward bool
+	}
+
+	tests := []struct {
+		name string
+		sort string
+		// the cursor the page is requested with, nil for the first page
+		cursor *cursor
+		// what the database returns, one row more than the page when there's more
+		rows      []int64
+		wantOrder string
+		wantWhere string
+		wantIDs   []int64
+		wantNext  *wantCursor
+		wantPrev  *wantCursor
+	}{
+		{
+			name:      "first page",
+			sort:      "id",
+			rows:      []int64{1, 2, 3},
+			wantOrder: "ORDER BY id ASC",
+			wantWhere: "AND TRUE",
+			wantIDs:   []int64{1, 2},
+			wantNext:  &wantCursor{keys: "[2]"},
+		},
+		{
+			name:      "only page",
+			sort:      "id",
+			rows:      []int64{1, 2},
+			wantOrder: "ORDER BY id ASC",
+			wantIDs:   []int64{1, 2},
+		},
+		{
+			name:      "forward",
+			sort:      "id",
+			cursor:    &cursor{Keys: rawKeys("2")},
+			rows:      []int64{3, 4, 5},
+			wantOrder: "ORDER BY id ASC",
+			wantWhere: "((id > $1))",
+			wantIDs:   []int64{3, 4},
+			wantNext:  &wantCursor{keys: "[4]"},
+			wantPrev:  &wantCursor{keys: "[3]", backward: true},
+		},
+		{
+			name:      "last page",
+			sort:      "id",
+			cursor:    &cursor{Keys: rawKeys("4")},
+			rows:      []int64{5},
+			wantOrder: "ORDER BY id ASC",
+			wantIDs:   []int64{5},
+			wantPrev:  &wantCursor{keys: "[5]", backward: true},
+		},
+		{
+			// the previous page is read in reverse and flipped back
+			name:      "backward",
+			sort:      "id",
+			cursor:    &cursor{Keys: rawKeys("5"), Backward: true},
+			rows:      []int64{4, 3, 2},
+			wantOrder: "ORDER BY id DESC",
+			wantWhere: "((id < $1))",
+			wantIDs:   []int64{3, 4},
+			wantNext:  &wantCursor{keys: "[4]"},
+			wantPrev:  &wantCursor{keys: "[3]", backward: true},
+		},
+		{
+			name:      "backward to the first page",
+			sort:      "id",
+			cursor:    &cursor{Keys: rawKeys("3"), Backward: true},
+			rows:      []int64{2, 1},
+			wantOrder: "ORDER BY id DESC",
+			wantIDs:   []int64{1, 2},
+			wantNext:  &wantCursor{keys: "[2]"},
+		},
+		{
+			name:      "desc first page",
+			sort:      "-year",
+			rows:      []int64{1, 2, 3},
+			wantOrder: "ORDER BY year DESC, id ASC",
+			wantIDs:   []int64{1, 2},
+			wantNext:  &wantCursor{keys: "[2008,2]"},
+		},
+		{
+			name:      "desc forward",
+			sort:      "-year",
+			cursor:    &cursor{Keys: rawKeys("2008", "2")},
+			rows:      []int64{3},
+			wantOrder: "ORDER BY year DESC, id ASC",
+			wantWhere: "((year < $1) OR (year = $1 AND id > $2))",
+			wantIDs:   []int64{3},
+			wantPrev:  &wantCursor{keys: "[2007,3]", backward: true},
+		},
+		{
+			name:      "desc backward",
+			sort:      "-year",
+			cursor:    &cursor{Keys: rawKeys("2007", "3"), Backward: true},
+			rows:      []int64{2, 1},
+			wantOrder: "ORDER BY year ASC, id DESC",
+			wantWhere: "((year > $1) OR (year = $1 AND id < $2))",
+			wantIDs:   []int64{1, 2},
+			wantNext:  &wantCursor{keys: "[2008,2]"},
+		},
+		{
+			// the rows of the cursor were deleted in the meantime
+			name:      "empty page",
+			sort:      "id",
+			cursor:    &cursor{Keys: rawKeys("9")},
+			rows:      nil,
+			wantOrder: "ORDER BY id ASC",
+			wantIDs:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query string
+			db := sqlstub.Open(func(q string, args []driver.NamedValue) sqlstub.Result {
+				query = q
+				return cursorMovieRows(tt.rows...)
+			})
+			defer db.Close()
+
+			filters := Filters{PageSize: 2, Sort: tt.sort, SortSafeList: []string{"id", "-year"}, CursorMode: true, CursorSecret: testCursorSecret}
+			if tt.cursor != nil {
+				token, err := filters.encodeCursor(*tt.cursor)
+				if err != nil {
+					t.Fatal(err)
+				}
+				filters.Cursor = token
+			}
+
+			movies, metadata, err := MovieDAO{DB: db.DB}.GetAll(MovieFilters{}, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(query, tt.wantOrder) || !strings.Contains(query, tt.wantWhere) {
+				t.Errorf("query %s\nwant it to contain %q and %q", query, tt.wantOrder, tt.wantWhere)
+			}
+
+			var ids []int64
+			for _, movie := range movies {
+				ids = append(ids, movie.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("got ids %v, want %v", ids, tt.wantIDs)
+			}
+
+			checkCursor := func(name, token string, want *wantCursor) {
+				if want == nil {
+					if token != "" {
+						t.Errorf("got a %s cursor, want none", name)
+					}
+					return
+				}
+
+				c, err := decodeCursor(testCursorSecret, token)
+				if err != nil {
+					t.Fatalf("%s cursor: %v", name, err)
+				}
+				keys, _ := json.Marshal(c.Keys)
+				if string(keys) != want.keys || c.Backward != want.backward || c.Sort != tt.sort {
+					t.Errorf("got %s cursor keys %s backward %t sort %q, want keys %s backward %t sort %q",
+						name, keys, c.Backward, c.Sort, want.keys, want.backward, tt.sort)
+				}
+			}
+			checkCursor("next", metadata.NextCursor, tt.wantNext)
+			checkCursor("prev", metadata.PrevCursor, tt.wantPrev)
+		})
+	}
+}
+
+func TestGetAllByCursorKeyCount(t *testing.T) {
+	db := sqlstub.Open(func(query string, args []driver.NamedValue) sqlstub.Result {
+		return cursorMovieRows()
+	})
+	defer db.Close()
+
+	// a cursor of the id sort has one key, -year needs two
+	filters := Filters{PageSize: 2, Sort: "-year", SortSafeList: []string{"-year"}, CursorMode: true, CursorSecret: testCursorSecret}
+	filters.Cursor, _ = filters.encodeCursor(cursor{Keys: rawKeys("2")})
+
+	_, _, err := MovieDAO{DB: db.DB}.GetAll(MovieFilters{}, filters)
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("got error %v, want %v", err, ErrInvalidCursor)
+	}
+}
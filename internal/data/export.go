@@ -0,0 +1,89 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// rows fetched from the server-side cursor at a time
+const exportFetchSize = 1000
+
+// Export calls fn for every movie matching the filters, ordered by id. Rows
+// are read through a server-side cursor, so the whole result is never held
+// in memory. Reading stops at the first error from fn.
+func (dao MovieDAO) Export(ctx context.Context, movieFilters MovieFilters, fn func(*Movie) error) error {
+	tx, err := dao.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := queryArgs{}
+	query := `
+		DECLARE movies_export NO SCROLL CURSOR FOR
+		SELECT id, created_at, title, year, runtime, genres, version
+		FROM movies
+		WHERE ` + movieFilters.where(&args) + `
+		ORDER BY id`
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	for {
+		movies, err := exportFetch(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, movie := range movies {
+			err = fn(movie)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(movies) < exportFetchSize {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
+
+func exportFetch(ctx context.Context, tx *sql.Tx) ([]*Movie, error) {
+	// the export may take long, only a single fetch has to be quick
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM movies_export", exportFetchSize))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := make([]*Movie, 0, exportFetchSize)
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+
+	return movies, rows.Err()
+}
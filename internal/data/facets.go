@@ -0,0 +1,113 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"greenlight.vysotsky.com/internal/validator"
+)
+
+const (
+	FacetGenres  = "genres"
+	FacetDecade  = "decade"
+	FacetRuntime = "runtime"
+)
+
+// runtime facet buckets are this many minutes wide, the last one is open ended
+const (
+	runtimeBucketWidth = 30
+	runtimeBucketMax   = 180
+)
+
+// FacetCount is the number of matching movies with the given value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets holds the counts of each requested facet. Genres are listed by
+// count, decades and runtime buckets in their natural order.
+type Facets map[string][]FacetCount
+
+func ValidateFacets(v *validator.Validator, names []string) {
+	for _, name := range names {
+		v.Check(validator.In(name, FacetGenres, FacetDecade, FacetRuntime), "facets", "must be genres, decade or runtime")
+	}
+	v.Check(validator.Unique(names), "facets", "must not contain duplicate values")
+}
+
+// facetQueries select the facet name, the value, the count and an integer
+// to order the values by from the matched CTE
+var facetQueries = map[string]string{
+	FacetGenres: `
+		SELECT 'genres', genre, count(*), -count(*)
+		FROM matched, unnest(genres) AS genre
+		GROUP BY genre`,
+	FacetDecade: `
+		SELECT 'decade', (year / 10 * 10) || 's', count(*), year / 10 * 10
+		FROM matched
+		GROUP BY year / 10 * 10`,
+	FacetRuntime: fmt.Sprintf(`
+		SELECT 'runtime',
+			CASE WHEN bucket >= %[2]d THEN bucket || '+' ELSE bucket || '-' || (bucket + %[1]d - 1) END,
+			count(*), bucket
+		FROM (SELECT least(runtime / %[1]d * %[1]d, %[2]d) AS bucket FROM matched) AS buckets
+		GROUP BY bucket`, runtimeBucketWidth, runtimeBucketMax),
+}
+
+// GetFacets counts the movies matching the filters by each of the named facets
+func (dao MovieDAO) GetFacets(movieFilters MovieFilters, names []string) (Facets, error) {
+	facets := make(Facets, len(names))
+	if len(names) == 0 {
+		return facets, nil
+	}
+
+	branches := make([]string, len(names))
+	for i, name := range names {
+		query, ok := facetQueries[name]
+		if !ok {
+			panic("unknown facet: " + name) // ValidateFacets checks them
+		}
+		branches[i] = query
+		facets[name] = []FacetCount{}
+	}
+
+	args := queryArgs{}
+	query := `
+	WITH matched AS (
+		SELECT genres, year, runtime
+		FROM movies
+		WHERE %s
+	)
+	SELECT facet, value, count FROM (%s) AS facets (facet, value, count, position)
+	ORDER BY facet, position, value`
+
+	query = fmt.Sprintf(query, movieFilters.where(&args), strings.Join(branches, "\n\t\tUNION ALL"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := dao.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var count FacetCount
+		err := rows.Scan(&name, &count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		facets[name] = append(facets[name], count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
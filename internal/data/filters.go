@@ -1,25 +1,39 @@
 package data
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"strings"
+	"time"
 
 	"greenlight.vysotsky.com/internal/validator"
 )
 
+// sort=-year,title sorts by several keys, there is little use in many of them
+const maxSortKeys = 4
+
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+	// in cursor mode Page is ignored, an empty Cursor means the first page
+	CursorMode   bool
+	Cursor       string
+	CursorSecret []byte
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
+	// a close title when a title search found nothing
+	DidYouMean   string `json:"did_you_mean,omitempty"`
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -28,24 +42,79 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize > 0, "page_size", "must be greater than 0")
 	v.Check(f.PageSize <= 100, "page_size", "maximum value is 100")
 
-	v.Check(validator.In(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+	values := strings.Split(f.Sort, ",")
+	v.Check(len(values) <= maxSortKeys, "sort", fmt.Sprintf("must not have more than %d keys", maxSortKeys))
+	columns := make([]string, len(values))
+	for i, value := range values {
+		v.Check(validator.In(value, f.SortSafeList...), "sort", "invalid sort value")
+		columns[i] = strings.TrimPrefix(value, "-")
+	}
+	v.Check(validator.Unique(columns), "sort", "must not repeat a column")
+
+	if f.CursorMode && f.Cursor != "" {
+		c, err := f.decodeCursor()
+		v.Check(!errors.Is(err, ErrCursorExpired), "cursor", "has expired")
+		v.Check(err == nil || errors.Is(err, ErrCursorExpired), "cursor", "invalid cursor")
+		v.Check(err != nil || c.Sort == f.Sort, "cursor", "was issued for a different sort value")
+	}
+}
+
+func (f Filters) decodeCursor() (cursor, error) {
+	return decodeCursor(f.CursorSecret, f.Cursor)
+}
+
+func (f Filters) encodeCursor(c cursor) (string, error) {
+	c.Sort = f.Sort
+	c.Expires = time.Now().Add(cursorTTL).Unix()
+	return encodeCursor(f.CursorSecret, c)
+}
+
+// sortKey is one comma separated part of the sort parameter
+type sortKey struct {
+	column string
+	desc   bool
 }
 
-func (f Filters) sortColumn() string {
-	for _, safeValue := range f.SortSafeList {
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-")
+// sortKeys returns the keys of the sort parameter followed by id, so rows
+// with equal keys still come in the same order every time
+func (f Filters) sortKeys() []sortKey {
+	var keys []sortKey
+	for _, value := range strings.Split(f.Sort, ",") {
+		if !validator.In(value, f.SortSafeList...) {
+			panic("unsafe sort parameter: " + value) //this should never happen
+		}
+
+		column := strings.TrimPrefix(value, "-")
+		desc := column != value
+		// a higher rank is a better match, relevance lists those first
+		if column == "relevance" {
+			desc = !desc
+		}
+		keys = append(keys, sortKey{column: column, desc: desc})
+		// id is unique, nothing after it changes the order
+		if column == "id" {
+			return keys
 		}
 	}
 
-	panic("unsafe sort parameter: " + f.Sort) //this should never happen
+	return append(keys, sortKey{column: "id"})
 }
 
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
-		return "DESC"
+func (f Filters) orderBy() string {
+	return sortKeyOrder(f.sortKeys(), false)
+}
+
+// sortKeyOrder builds an ORDER BY clause, reversed flips every direction
+func sortKeyOrder(keys []sortKey, reversed bool) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		direction := "ASC"
+		if key.desc != reversed {
+			direction = "DESC"
+		}
+		parts[i] = key.column + " " + direction
 	}
-	return "ASC"
+	return strings.Join(parts, ", ")
 }
 
 func (f Filters) limit() int {
@@ -56,6 +125,40 @@ func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// keysetCondition returns the WHERE condition and ORDER BY clause which continue
+// a listing after (or, going backward, before) the cursor. keyArgs are the
+// placeholders of the cursor's keys, one for each of sortKeys. Rows are ordered
+// the same as in offset mode.
+func (f Filters) keysetCondition(c *cursor, keyArgs []string) (string, string) {
+	keys := f.sortKeys()
+	// read the previous page in reverse, the caller flips it back
+	backward := c != nil && c.Backward
+	orderBy := sortKeyOrder(keys, backward)
+
+	if c == nil {
+		return "TRUE", orderBy
+	}
+
+	// (k1 > $1) OR (k1 = $1 AND k2 > $2) OR ...
+	alternatives := make([]string, len(keys))
+	for i, key := range keys {
+		terms := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			terms = append(terms, fmt.Sprintf("%s = %s", keys[j].column, keyArgs[j]))
+		}
+
+		op := ">"
+		if key.desc != backward {
+			op = "<"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s %s", key.column, op, keyArgs[i]))
+
+		alternatives[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")", orderBy
+}
+
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	if totalRecords == 0 {
 		return Metadata{}
@@ -0,0 +1,135 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+
+	"greenlight.vysotsky.com/internal/validator"
+)
+
+var testSortSafeList = []string{"id", "-id", "title", "-title", "year", "-year", "runtime", "-runtime", "relevance", "-relevance"}
+
+func TestValidateFiltersSort(t *testing.T) {
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{sort: "title", want: ""},
+		{sort: "-year,title,runtime,id", want: ""},
+		{sort: "year,-year", want: "must not repeat a column"},
+		{sort: "title,title", want: "must not repeat a column"},
+		{sort: "title,", want: "invalid sort value"},
+		{sort: ",title", want: "invalid sort value"},
+		{sort: "title,,year", want: "invalid sort value"},
+		{sort: "", want: "invalid sort value"},
+		{sort: "director", want: "invalid sort value"},
+		{sort: "title,year,runtime,id,relevance", want: "must not have more than 4 keys"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			v := validator.New()
+			ValidateFilters(v, Filters{Page: 1, PageSize: 20, Sort: tt.sort, SortSafeList: testSortSafeList})
+			if got := v.Errors["sort"]; got != tt.want {
+				t.Errorf("got sort error %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortKeys(t *testing.T) {
+	tests := []struct {
+		sort string
+		want []sortKey
+	}{
+		{sort: "title", want: []sortKey{{column: "title"}, {column: "id"}}},
+		{sort: "-year,title", want: []sortKey{{column: "year", desc: true}, {column: "title"}, {column: "id"}}},
+		{sort: "-id", want: []sortKey{{column: "id", desc: true}}},
+		// id is unique, the keys after it are dropped
+		{sort: "year,id,title", want: []sortKey{{column: "year"}, {column: "id"}}},
+		{sort: "-id,-year", want: []sortKey{{column: "id", desc: true}}},
+		// relevance lists the best matches first, -relevance the worst
+		{sort: "relevance", want: []sortKey{{column: "relevance", desc: true}, {column: "id"}}},
+		{sort: "-relevance", want: []sortKey{{column: "relevance"}, {column: "id"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			got := Filters{Sort: tt.sort, SortSafeList: testSortSafeList}.sortKeys()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		sort      string
+		cursor    *cursor
+		keyArgs   []string
+		wantWhere string
+		wantOrder string
+	}{
+		{
+			name:      "first page",
+			sort:      "-year,title",
+			wantWhere: "TRUE",
+			wantOrder: "year DESC, title ASC, id ASC",
+		},
+		{
+			name:      "forward",
+			sort:      "title",
+			cursor:    &cursor{},
+			keyArgs:   []string{"$1", "$2"},
+			wantWhere: "((title > $1) OR (title = $1 AND id > $2))",
+			wantOrder: "title ASC, id ASC",
+		},
+		{
+			name:      "mixed directions",
+			sort:      "-year,title",
+			cursor:    &cursor{},
+			keyArgs:   []string{"$3", "$4", "$5"},
+			wantWhere: "((year < $3) OR (year = $3 AND title > $4) OR (year = $3 AND title = $4 AND id > $5))",
+			wantOrder: "year DESC, title ASC, id ASC",
+		},
+		{
+			name:      "mixed directions backward",
+			sort:      "-year,title",
+			cursor:    &cursor{Backward: true},
+			keyArgs:   []string{"$3", "$4", "$5"},
+			wantWhere: "((year > $3) OR (year = $3 AND title < $4) OR (year = $3 AND title = $4 AND id < $5))",
+			wantOrder: "year ASC, title DESC, id DESC",
+		},
+		{
+			name:      "relevance",
+			sort:      "relevance",
+			cursor:    &cursor{},
+			keyArgs:   []string{"$1", "$2"},
+			wantWhere: "((relevance < $1) OR (relevance = $1 AND id > $2))",
+			wantOrder: "relevance DESC, id ASC",
+		},
+		{
+			name:      "desc id only",
+			sort:      "-id",
+			cursor:    &cursor{},
+			keyArgs:   []string{"$1"},
+			wantWhere: "((id < $1))",
+			wantOrder: "id DESC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{Sort: tt.sort, SortSafeList: testSortSafeList}
+			where, orderBy := f.keysetCondition(tt.cursor, tt.keyArgs)
+			if where != tt.wantWhere {
+				t.Errorf("got condition %s, want %s", where, tt.wantWhere)
+			}
+			if orderBy != tt.wantOrder {
+				t.Errorf("got order %s, want %s", orderBy, tt.wantOrder)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MovieImport inserts movies in batches within a single transaction
+type MovieImport struct {
+	ctx    context.Context
+	tx     *sql.Tx
+	userID int64
+}
+
+// BeginImport starts the transaction of an import. It's rolled back when ctx
+// is done, so an import abandoned by its client doesn't hold it open.
+func (dao MovieDAO) BeginImport(ctx context.Context, userID int64) (*MovieImport, error) {
+	tx, err := dao.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &MovieImport{ctx: ctx, tx: tx, userID: userID}, nil
+}
+
+// Insert adds the movies with one INSERT and records their first revisions.
+// IDs, creation times and versions are set on the movies.
+func (i *MovieImport) Insert(movies []*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	titles := make([]string, len(movies))
+	years := make([]int64, len(movies))
+	runtimes := make([]int64, len(movies))
+	// unnest flattens nested arrays, so each movie's genres are passed as an
+	// array literal and cast back per row
+	genres := make([]string, len(movies))
+	for n, movie := range movies {
+		literal, err := pq.StringArray(movie.Genres).Value()
+		if err != nil {
+			return err
+		}
+		titles[n], years[n], runtimes[n], genres[n] = movie.Title, int64(movie.Year), int64(movie.Runtime), literal.(string)
+	}
+
+	// RETURNING comes in no particular order and can't refer to the input,
+	// so the ids are drawn up front and the rows are matched by them
+	query := `
+		WITH input AS (
+			SELECT nextval(pg_get_serial_sequence('movies', 'id')) AS id, t.*
+			FROM unnest($1::text[], $2::integer[], $3::integer[], $4::text[])
+				WITH ORDINALITY AS t(title, year, runtime, genres, n)
+		), inserted AS (
+			INSERT INTO movies (id, title, year, runtime, genres)
+			SELECT id, title, year, runtime, genres::text[]
+			FROM input
+			RETURNING id, created_at, version
+		)
+		SELECT input.n, inserted.id, inserted.created_at, inserted.version
+		FROM inserted JOIN input USING (id)`
+
+	ctx, cancel := context.WithTimeout(i.ctx, 10*time.Second)
+	defer cancel()
+
+	rows, err := i.tx.QueryContext(ctx, query, pq.Array(titles), pq.Array(years), pq.Array(runtimes), pq.Array(genres))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0, len(movies))
+	for rows.Next() {
+		// ordinality counts from 1
+		var n int
+		var movie Movie
+		err := rows.Scan(&n, &movie.ID, &movie.CreatedAt, &movie.Version)
+		if err != nil {
+			return err
+		}
+		if n < 1 || n > len(movies) {
+			return fmt.Errorf("inserted row %d of %d movies", n, len(movies))
+		}
+		movies[n-1].ID, movies[n-1].CreatedAt, movies[n-1].Version = movie.ID, movie.CreatedAt, movie.Version
+		ids = append(ids, movie.ID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return insertRevisions(ctx, i.tx, ids, i.userID)
+}
+
+func (i *MovieImport) Commit() error {
+	return i.tx.Commit()
+}
+
+func (i *MovieImport) Rollback() error {
+	return i.tx.Rollback()
+}
@@ -0,0 +1,70 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.vysotsky.com/internal/sqlstub"
+)
+
+func TestMovieImportInsert(t *testing.T) {
+	var titles, genres []string
+	db := sqlstub.Open(func(query string, args []driver.NamedValue) sqlstub.Result {
+		if !strings.Contains(query, "INSERT INTO movies") {
+			return sqlstub.Result{}
+		}
+		titles = *args[0].Value.(*pq.StringArray)
+		genres = *args[3].Value.(*pq.StringArray)
+
+		// Postgres doesn't promise any order, answer with the last movie first
+		result := sqlstub.Result{Columns: []string{"n", "id", "created_at", "version"}}
+		for n := int64(len(titles)); n > 0; n-- {
+			result.Rows = append(result.Rows, []driver.Value{n, 100 + n, time.Unix(n, 0), int64(1)})
+		}
+		return result
+	})
+	defer db.Close()
+
+	movies := []*Movie{
+		{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation", "adventure"}},
+		{Title: "Up", Year: 2009, Runtime: 96, Genres: []string{"animation"}},
+		{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime", "drama, thriller"}},
+	}
+
+	movieImport, err := MovieDAO{DB: db.DB}.BeginImport(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = movieImport.Insert(movies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"Moana", "Up", "Heat"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("got titles %q, want %q", titles, want)
+	}
+	// each genre is quoted, so the cast doesn't split one with a comma
+	if want := []string{`{"animation","adventure"}`, `{"animation"}`, `{"crime","drama, thriller"}`}; !reflect.DeepEqual(genres, want) {
+		t.Errorf("got genres %q, want %q", genres, want)
+	}
+
+	for n, movie := range movies {
+		id := int64(101 + n)
+		if movie.ID != id || !movie.CreatedAt.Equal(time.Unix(int64(n+1), 0)) {
+			t.Errorf("%s got id %d created at %v, want id %d", movie.Title, movie.ID, movie.CreatedAt, id)
+		}
+	}
+
+	revised := false
+	for _, query := range db.Queries() {
+		revised = revised || strings.Contains(query, "INSERT INTO movie_revisions")
+	}
+	if !revised {
+		t.Error("no revisions recorded")
+	}
+}
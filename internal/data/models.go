@@ -12,12 +12,20 @@ var (
 
 type Models struct {
 	Movies MovieDAO
+	Revisions RevisionDAO
 	Users UserDao
+	Tokens TokenDAO
+	Permissions PermissionDAO
+	Stats StatsDAO
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models {
 		Movies: MovieDAO{DB: db},
+		Revisions: RevisionDAO{DB: db},
 		Users: UserDao{DB: db},
+		Tokens: TokenDAO{DB: db},
+		Permissions: PermissionDAO{DB: db},
+		Stats: StatsDAO{DB: db},
 	}
 }
\ No newline at end of file
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.vysotsky.com/internal/validator"
+)
+
+const (
+	GenresModeAll = "all"
+	GenresModeAny = "any"
+)
+
+// announced movies have a year, but not many years ahead
+const maxFilterYearsAhead = 10
+
+// MovieFilters selects which movies are listed, zero values mean no filter
+type MovieFilters struct {
+	Title string
+	// Fuzzy matches titles by trigram similarity, so misspelled ones are found
+	Fuzzy         bool
+	Genres        []string
+	GenresMode    string
+	ExcludeGenres []string
+	YearMin       int
+	YearMax       int
+	RuntimeMin    int
+	RuntimeMax    int
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+func ValidateMovieFilters(v *validator.Validator, f MovieFilters) {
+	if f.Fuzzy {
+		v.Check(strings.TrimSpace(f.Title) != "", "title", "must be provided for a fuzzy search")
+	} else {
+		v.Check(f.Title == "" || searchQuery(f.Title) != "", "title", "must contain a word to search for")
+	}
+	v.Check(validator.In(f.GenresMode, GenresModeAll, GenresModeAny), "genres_mode", "must be all or any")
+
+	maxYear := time.Now().Year() + maxFilterYearsAhead
+	v.Check(f.YearMin >= 0, "year_min", "must not be negative")
+	v.Check(f.YearMin <= maxYear, "year_min", fmt.Sprintf("must not be greater than %d", maxYear))
+	v.Check(f.YearMax >= 0, "year_max", "must not be negative")
+	v.Check(f.YearMax <= maxYear, "year_max", fmt.Sprintf("must not be greater than %d", maxYear))
+	v.Check(f.YearMax == 0 || f.YearMin <= f.YearMax, "year_max", "must not be less than year_min")
+
+	// runtime is an integer column, larger values would fail the query
+	v.Check(f.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(f.RuntimeMin <= math.MaxInt32, "runtime_min", "must not be greater than 2147483647")
+	v.Check(f.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	v.Check(f.RuntimeMax <= math.MaxInt32, "runtime_max", "must not be greater than 2147483647")
+	v.Check(f.RuntimeMax == 0 || f.RuntimeMin <= f.RuntimeMax, "runtime_max", "must not be less than runtime_min")
+
+	v.Check(f.CreatedBefore.IsZero() || f.CreatedAfter.Before(f.CreatedBefore), "created_before", "must be later than created_after")
+}
+
+// CacheKey identifies the movies the filters match. Filters which are written
+// differently but match the same movies, like genres in another order or a
+// title search with other spacing, get the same key.
+func (f MovieFilters) CacheKey() string {
+	title := f.Title
+	if !f.Fuzzy {
+		title = searchQuery(f.Title)
+	}
+
+	genresMode := ""
+	if len(f.Genres) > 0 {
+		genresMode = f.GenresMode
+	}
+
+	return fmt.Sprintf("%q %t %q %s %q %d %d %d %d %s %s",
+		title, f.Fuzzy, sortedSet(f.Genres), genresMode, sortedSet(f.ExcludeGenres),
+		f.YearMin, f.YearMax, f.RuntimeMin, f.RuntimeMax,
+		cacheKeyTime(f.CreatedAfter), cacheKeyTime(f.CreatedBefore))
+}
+
+func sortedSet(values []string) []string {
+	values = slices.Clone(values)
+	slices.Sort(values)
+	return slices.Compact(values)
+}
+
+func cacheKeyTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// queryArgs collects positional query arguments
+type queryArgs []interface{}
+
+// add appends the value and returns its placeholder
+func (a *queryArgs) add(value interface{}) string {
+	*a = append(*a, value)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// where returns the WHERE condition for the filters. Only the filters which
+// are set end up in the query, so the planner can use the title and genres
+// indexes instead of working around conditions like "OR $1 = '{}'".
+func (f MovieFilters) where(args *queryArgs) string {
+	conditions := []string{"deleted_at IS NULL"}
+	add := func(format string, value interface{}) {
+		conditions = append(conditions, fmt.Sprintf(format, args.add(value)))
+	}
+
+	switch {
+	case f.Fuzzy && f.Title != "":
+		// % compares against pg_trgm.similarity_threshold and uses the trigram index
+		add("title %% %s", f.Title)
+	case searchQuery(f.Title) != "":
+		add("to_tsvector('simple', title) @@ to_tsquery('simple', %s)", searchQuery(f.Title))
+	}
+	if len(f.Genres) > 0 {
+		if f.GenresMode == GenresModeAny {
+			add("genres && %s", pq.Array(f.Genres))
+		} else {
+			add("genres @> %s", pq.Array(f.Genres))
+		}
+	}
+	if len(f.ExcludeGenres) > 0 {
+		add("NOT (genres && %s)", pq.Array(f.ExcludeGenres))
+	}
+	if f.YearMin > 0 {
+		add("year >= %s", f.YearMin)
+	}
+	if f.YearMax > 0 {
+		add("year <= %s", f.YearMax)
+	}
+	if f.RuntimeMin > 0 {
+		add("runtime >= %s", f.RuntimeMin)
+	}
+	if f.RuntimeMax > 0 {
+		add("runtime <= %s", f.RuntimeMax)
+	}
+	if !f.CreatedAfter.IsZero() {
+		add("created_at > %s", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		add("created_at < %s", f.CreatedBefore)
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// htmlEscapedTitle escapes the title like html.EscapeString does
+const htmlEscapedTitle = `replace(replace(replace(replace(replace(title, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+
+// searchColumns returns the relevance and headline select columns, both are
+// NULL when there is no title search. ORDER BY can refer to relevance. A fuzzy
+// search is ranked by similarity and has no headline.
+func (f MovieFilters) searchColumns(args *queryArgs) string {
+	if f.Fuzzy && f.Title != "" {
+		return fmt.Sprintf("similarity(title, %s) AS relevance, NULL::text AS headline", args.add(f.Title))
+	}
+
+	query := searchQuery(f.Title)
+	if query == "" {
+		return "NULL::real AS relevance, NULL::text AS headline"
+	}
+
+	// the headline is meant to be rendered as HTML, so the title is escaped
+	// before the <mark> tags are added. The parser reads entities as single
+	// tokens, they don't match search words.
+	arg := args.add(query)
+	return fmt.Sprintf(`ts_rank_cd(to_tsvector('simple', title), to_tsquery('simple', %[1]s)) AS relevance,
+	ts_headline('simple', %[2]s, to_tsquery('simple', %[1]s), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') AS headline`, arg, htmlEscapedTitle)
+}
@@ -0,0 +1,129 @@
+package data
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"greenlight.vysotsky.com/internal/validator"
+)
+
+func TestMovieFiltersCacheKey(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	same := []struct {
+		name string
+		a, b MovieFilters
+	}{
+		{
+			name: "title spelling",
+			a:    MovieFilters{Title: "Star  Wars!"},
+			b:    MovieFilters{Title: "star wars"},
+		},
+		{
+			name: "genre order and duplicates",
+			a:    MovieFilters{Genres: []string{"drama", "action"}, ExcludeGenres: []string{"horror", "horror"}},
+			b:    MovieFilters{Genres: []string{"action", "drama"}, ExcludeGenres: []string{"horror"}},
+		},
+		{
+			name: "genres mode without genres",
+			a:    MovieFilters{GenresMode: GenresModeAll},
+			b:    MovieFilters{GenresMode: GenresModeAny},
+		},
+		{
+			name: "time zone",
+			a:    MovieFilters{CreatedAfter: created},
+			b:    MovieFilters{CreatedAfter: created.In(time.FixedZone("UTC+2", 2*60*60))},
+		},
+	}
+	for _, tt := range same {
+		if tt.a.CacheKey() != tt.b.CacheKey() {
+			t.Errorf("%s: got keys %s and %s, want them equal", tt.name, tt.a.CacheKey(), tt.b.CacheKey())
+		}
+	}
+
+	different := []struct {
+		name string
+		a, b MovieFilters
+	}{
+		{
+			name: "fuzzy title",
+			a:    MovieFilters{Title: "Star Wars", Fuzzy: true},
+			b:    MovieFilters{Title: "star wars", Fuzzy: true},
+		},
+		{
+			name: "genres mode",
+			a:    MovieFilters{Genres: []string{"drama"}, GenresMode: GenresModeAll},
+			b:    MovieFilters{Genres: []string{"drama"}, GenresMode: GenresModeAny},
+		},
+		{
+			name: "included and excluded genres",
+			a:    MovieFilters{Genres: []string{"drama"}},
+			b:    MovieFilters{ExcludeGenres: []string{"drama"}},
+		},
+		{
+			name: "year and runtime",
+			a:    MovieFilters{YearMin: 90},
+			b:    MovieFilters{RuntimeMin: 90},
+		},
+		{
+			name: "created after and before",
+			a:    MovieFilters{CreatedAfter: created},
+			b:    MovieFilters{CreatedBefore: created},
+		},
+		{
+			name: "genre names with separators",
+			a:    MovieFilters{Genres: []string{"a b"}},
+			b:    MovieFilters{Genres: []string{"a", "b"}},
+		},
+	}
+	for _, tt := range different {
+		if tt.a.CacheKey() == tt.b.CacheKey() {
+			t.Errorf("%s: got key %s for both, want them different", tt.name, tt.a.CacheKey())
+		}
+	}
+}
+
+func TestValidateMovieFilters(t *testing.T) {
+	maxYear := time.Now().Year() + maxFilterYearsAhead
+
+	tests := []struct {
+		name    string
+		filters MovieFilters
+		// the fields with errors
+		want []string
+	}{
+		{name: "no filters", filters: MovieFilters{}},
+		{name: "ranges", filters: MovieFilters{YearMin: 1990, YearMax: 1999, RuntimeMin: 90, RuntimeMax: 120}},
+		{name: "equal bounds", filters: MovieFilters{YearMin: 1999, YearMax: 1999, RuntimeMin: 90, RuntimeMax: 90}},
+		{name: "only a minimum", filters: MovieFilters{YearMin: 1990, RuntimeMin: 90}},
+		{name: "largest values", filters: MovieFilters{YearMin: maxYear, YearMax: maxYear, RuntimeMin: math.MaxInt32, RuntimeMax: math.MaxInt32}},
+		{name: "negative", filters: MovieFilters{YearMin: -1, YearMax: -1, RuntimeMin: -1, RuntimeMax: -1}, want: []string{"year_min", "year_max", "runtime_min", "runtime_max"}},
+		{name: "year too large", filters: MovieFilters{YearMin: maxYear + 1, YearMax: maxYear + 1}, want: []string{"year_min", "year_max"}},
+		// past int32 the query would fail with an out of range error
+		{name: "runtime too large", filters: MovieFilters{RuntimeMin: math.MaxInt32 + 1, RuntimeMax: math.MaxInt32 + 1}, want: []string{"runtime_min", "runtime_max"}},
+		{name: "year min above max", filters: MovieFilters{YearMin: 2000, YearMax: 1999}, want: []string{"year_max"}},
+		{name: "runtime min above max", filters: MovieFilters{RuntimeMin: 121, RuntimeMax: 120}, want: []string{"runtime_max"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filters.GenresMode = GenresModeAll
+
+			v := validator.New()
+			ValidateMovieFilters(v, tt.filters)
+
+			var got []string
+			for field := range v.Errors {
+				got = append(got, field)
+			}
+			slices.Sort(got)
+			want := slices.Clone(tt.want)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("got errors %v, want errors for %v", v.Errors, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -12,13 +13,16 @@ import (
 )
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title,omitempty"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ID        int64      `json:"id"`
+	CreatedAt time.Time  `json:"-"`
+	Title     string     `json:"title,omitempty"`
+	Year      int32      `json:"year,omitempty"`
+	Runtime   Runtime    `json:"runtime,omitempty"`
+	Genres    []string   `json:"genres,omitempty"`
+	Version   int32      `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// only set when listing with a title search
+	Search *MovieSearch `json:"search,omitempty"`
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
@@ -41,22 +45,27 @@ type MovieDAO struct {
 	DB *sql.DB
 }
 
-func (dao MovieDAO) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (dao MovieDAO) GetAll(movieFilters MovieFilters, filters Filters) ([]*Movie, Metadata, error) {
+	if filters.CursorMode {
+		return dao.getAllByCursor(movieFilters, filters)
+	}
+
+	args := queryArgs{}
+	where := movieFilters.where(&args)
+	search := movieFilters.searchColumns(&args)
+
 	query := `
-	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version 
+	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, %s
 	FROM movies
-	WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-	AND (genres @> $2 OR $2 = '{}')
-	ORDER BY %s %s, id ASC
-	LIMIT $3 OFFSET $4`
+	WHERE %s
+	ORDER BY %s
+	LIMIT %s OFFSET %s`
 
-	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+	query = fmt.Sprintf(query, search, where, filters.orderBy(), args.add(filters.limit()), args.add(filters.offset()))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
-
 	rows, err := dao.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
@@ -67,6 +76,7 @@ func (dao MovieDAO) GetAll(title string, genres []string, filters Filters) ([]*M
 	var totalRecords int
 	for rows.Next() {
 		var movie Movie
+		var search searchResult
 		err := rows.Scan(
 			&totalRecords,
 			&movie.ID,
@@ -76,10 +86,13 @@ func (dao MovieDAO) GetAll(title string, genres []string, filters Filters) ([]*M
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&search.rank,
+			&search.headline,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
+		movie.Search = search.movieSearch()
 		movies = append(movies, &movie)
 	}
 
@@ -89,10 +102,198 @@ func (dao MovieDAO) GetAll(title string, genres []string, filters Filters) ([]*M
 
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 
+	// past the last page nothing is returned either, only an empty first
+	// page means the search found nothing
+	if totalRecords == 0 && filters.Page == 1 && !movieFilters.Fuzzy {
+		metadata.DidYouMean, err = dao.didYouMean(movieFilters.Title)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
 	return movies, metadata, nil
 
 }
 
+// didYouMean returns the title most similar to the words of the search, or an
+// empty string if there are none, no title is similar enough or the search
+// matches titles by itself
+func (dao MovieDAO) didYouMean(search string) (string, error) {
+	text := searchText(search)
+	if text == "" {
+		return "", nil
+	}
+
+	// the other filters may be what left nothing to list, then the title
+	// isn't misspelled and there is nothing to suggest
+	args := queryArgs{text}
+	titleOnly := MovieFilters{Title: search}.where(&args)
+
+	query := `
+	SELECT title
+	FROM movies
+	WHERE title % $1 AND deleted_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM movies WHERE ` + titleOnly + `)
+	ORDER BY similarity(title, $1) DESC, id ASC
+	LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var suggestion string
+	err := dao.DB.QueryRowContext(ctx, query, args...).Scan(&suggestion)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	return suggestion, nil
+}
+
+// getAllByCursor pages with keyset conditions instead of OFFSET, so deep pages
+// cost the same as the first one. Total counts are not reported in this mode.
+func (dao MovieDAO) getAllByCursor(movieFilters MovieFilters, filters Filters) ([]*Movie, Metadata, error) {
+	var c *cursor
+	args := queryArgs{}
+	where := movieFilters.where(&args)
+	search := movieFilters.searchColumns(&args)
+	var keyArgs []string
+
+	if filters.Cursor != "" {
+		decoded, err := filters.decodeCursor()
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		keys, err := decoded.keyValues()
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		if len(keys) != len(filters.sortKeys()) {
+			return nil, Metadata{}, ErrInvalidCursor
+		}
+		c = &decoded
+		for _, key := range keys {
+			keyArgs = append(keyArgs, args.add(key))
+		}
+	}
+
+	condition, orderBy := filters.keysetCondition(c, keyArgs)
+
+	query := `
+	SELECT id, created_at, title, year, runtime, genres, version, %s
+	FROM movies
+	WHERE %s
+	AND %s
+	ORDER BY %s
+	LIMIT %s`
+
+	query = fmt.Sprintf(query, search, where, condition, orderBy, args.add(filters.limit()+1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := dao.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+		var search searchResult
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&search.rank,
+			&search.headline,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movie.Search = search.movieSearch()
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// one extra row was requested to find out whether there is another page
+	hasMore := len(movies) > filters.limit()
+	if hasMore {
+		movies = movies[:filters.limit()]
+	}
+
+	backward := c != nil && c.Backward
+	if backward {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+	if len(movies) == 0 {
+		if c == nil && !movieFilters.Fuzzy {
+			metadata.DidYouMean, err = dao.didYouMean(movieFilters.Title)
+			if err != nil {
+				return nil, Metadata{}, err
+			}
+		}
+		return movies, metadata, nil
+	}
+
+	hasNext := hasMore || backward
+	hasPrev := (hasMore && backward) || (c != nil && !backward)
+
+	if hasNext {
+		metadata.NextCursor, err = filters.movieCursor(movies[len(movies)-1], false)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+	if hasPrev {
+		metadata.PrevCursor, err = filters.movieCursor(movies[0], true)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	return movies, metadata, nil
+}
+
+func (f Filters) movieCursor(movie *Movie, backward bool) (string, error) {
+	keys := f.sortKeys()
+	values := make([]json.RawMessage, len(keys))
+	for i, key := range keys {
+		var value interface{}
+		switch key.column {
+		case "id":
+			value = movie.ID
+		case "title":
+			value = movie.Title
+		case "year":
+			value = movie.Year
+		case "runtime":
+			// Runtime marshals to "N mins", the column holds a plain integer
+			value = int32(movie.Runtime)
+		default:
+			panic("no cursor key for sort parameter: " + f.Sort)
+		}
+
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		values[i] = raw
+	}
+
+	return f.encodeCursor(cursor{Keys: values, Backward: backward})
+}
+
 func (dao MovieDAO) GET(id int64) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
@@ -101,7 +302,7 @@ func (dao MovieDAO) GET(id int64) (*Movie, error) {
 	query := `
 	SELECT id, created_at, title, year, runtime, genres, version 
 	FROM movies 
-	WHERE id=$1`
+	WHERE id=$1 AND deleted_at IS NULL`
 
 	movie := Movie{}
 
@@ -128,7 +329,8 @@ func (dao MovieDAO) GET(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-func (dao MovieDAO) Insert(movie *Movie) error {
+// Insert creates the movie together with its first revision, userID is the editor
+func (dao MovieDAO) Insert(movie *Movie, userID int64) error {
 	query := `
 		INSERT INTO movies (title, year, runtime, genres)
 		VALUES ($1, $2, $3, $4)
@@ -139,14 +341,31 @@ func (dao MovieDAO) Insert(movie *Movie) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return dao.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	tx, err := dao.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(ctx, tx, movie.ID, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (dao MovieDAO) Update(movie *Movie) error {
+// Update saves the movie as a new version and records it as a revision
+func (dao MovieDAO) Update(movie *Movie, userID int64) error {
 	query := `
 		UPDATE movies
 		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-		WHERE id = $5 and version = $6
+		WHERE id = $5 and version = $6 AND deleted_at IS NULL
 		RETURNING version`
 	args := []interface{}{
 		movie.Title,
@@ -160,7 +379,13 @@ func (dao MovieDAO) Update(movie *Movie) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := dao.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	tx, err := dao.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -170,17 +395,212 @@ func (dao MovieDAO) Update(movie *Movie) error {
 		}
 	}
 
-	return nil
+	err = insertRevision(ctx, tx, movie.ID, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (dao MovieDAO) Delete(id int64) error {
+// Delete moves the movie to the trash as a new version, userID is the editor
+func (dao MovieDAO) Delete(id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// the movie goes to the trash, it can be restored until it is purged
+	query := `
+		UPDATE movies
+		SET deleted_at = now(), version = version + 1
+		WHERE id=$1 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := dao.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = insertRevision(ctx, tx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteVersion deletes the movie only if it's still at the given version.
+// It returns ErrRecordNotFound when there is no such movie and ErrEditConflict
+// when it was changed in the meantime.
+func (dao MovieDAO) DeleteVersion(id int64, version int32, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// both subqueries see the table as it was before the delete
+	query := `
+		WITH deleted AS (
+			UPDATE movies
+			SET deleted_at = now(), version = version + 1
+			WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+			RETURNING id
+		)
+		SELECT
+			EXISTS (SELECT 1 FROM deleted),
+			EXISTS (SELECT 1 FROM movies WHERE id = $1 AND deleted_at IS NULL)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := dao.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deleted, exists bool
+	err = tx.QueryRowContext(ctx, query, id, version).Scan(&deleted, &exists)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !deleted && !exists:
+		return ErrRecordNotFound
+	case !deleted:
+		return ErrEditConflict
+	}
+
+	err = insertRevision(ctx, tx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTrash lists soft deleted movies
+func (dao MovieDAO) GetTrash(filters Filters) ([]*Movie, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, deleted_at
+	FROM movies
+	WHERE deleted_at IS NOT NULL
+	ORDER BY %s
+	LIMIT $1 OFFSET $2`
+
+	query = fmt.Sprintf(query, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := dao.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	var totalRecords int
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
+// Restore takes the movie out of the trash, as a new version
+func (dao MovieDAO) Restore(id int64, userID int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE movies
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING id, created_at, title, year, runtime, genres, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := dao.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var movie Movie
+	err = tx.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = insertRevision(ctx, tx, movie.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &movie, tx.Commit()
+}
+
+// Purge permanently deletes a movie, it must be in the trash already
+func (dao MovieDAO) Purge(id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
 		DELETE FROM movies
-		WHERE id=$1`
+		WHERE id = $1 AND deleted_at IS NOT NULL`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -198,3 +618,19 @@ func (dao MovieDAO) Delete(id int64) error {
 	}
 	return nil
 }
+
+// PurgeDeletedBefore permanently deletes movies which were in the trash since before t
+func (dao MovieDAO) PurgeDeletedBefore(t time.Time) (int64, error) {
+	query := `
+		DELETE FROM movies
+		WHERE deleted_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := dao.DB.ExecContext(ctx, query, t)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
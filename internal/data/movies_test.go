@@ -0,0 +1,182 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"greenlight.vysotsky.com/internal/migrate"
+	"greenlight.vysotsky.com/internal/sqlstub"
+	"greenlight.vysotsky.com/migrations"
+)
+
+// deleteVersionDB answers the DeleteVersion query with whether the movie was
+// deleted and whether a live movie with the id exists
+func deleteVersionDB(deleted, exists bool) *sqlstub.DB {
+	return sqlstub.Open(func(query string, args []driver.NamedValue) sqlstub.Result {
+		if !strings.Contains(query, "WITH deleted AS") {
+			return sqlstub.Result{}
+		}
+		return sqlstub.Result{
+			Columns: []string{"deleted", "exists"},
+			Rows:    [][]driver.Value{{deleted, exists}},
+		}
+	})
+}
+
+func TestDeleteVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      int64
+		deleted bool
+		exists  bool
+		want    error
+	}{
+		{name: "deleted", id: 1, deleted: true, exists: true, want: nil},
+		// trashed movies don't count as existing, so they end up here too
+		{name: "missing or trashed", id: 1, deleted: false, exists: false, want: ErrRecordNotFound},
+		{name: "stale version", id: 1, deleted: false, exists: true, want: ErrEditConflict},
+		{name: "invalid id", id: 0, want: ErrRecordNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := deleteVersionDB(tt.deleted, tt.exists)
+			defer db.Close()
+
+			err := MovieDAO{DB: db.DB}.DeleteVersion(tt.id, 3, 7)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+
+			// trashing is a new version, so it must be recorded as a revision
+			revised := false
+			for _, query := range db.Queries() {
+				revised = revised || strings.Contains(query, "INSERT INTO movie_revisions")
+			}
+			if revised != (tt.want == nil) {
+				t.Errorf("got revision recorded %t, want %t", revised, tt.want == nil)
+			}
+		})
+	}
+}
+
+// TestDeleteVersionPostgres runs against a real database, which checks the
+// query itself rather than how its result is interpreted. It's skipped unless
+// GREENLIGHT_TEST_DB_DSN points at a database the test may migrate.
+func TestDeleteVersionPostgres(t *testing.T) {
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("GREENLIGHT_TEST_DB_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Up(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	movies := MovieDAO{DB: db}
+	movie := &Movie{Title: "Delete Version Test", Year: 2000, Runtime: 90, Genres: []string{"test"}}
+	err = movies.Insert(movie, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer movies.Purge(movie.ID)
+
+	err = movies.DeleteVersion(math.MaxInt64, 1, 0)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("missing movie: got error %v, want %v", err, ErrRecordNotFound)
+	}
+
+	err = movies.DeleteVersion(movie.ID, movie.Version+1, 0)
+	if !errors.Is(err, ErrEditConflict) {
+		t.Errorf("stale version: got error %v, want %v", err, ErrEditConflict)
+	}
+
+	err = movies.DeleteVersion(movie.ID, movie.Version, 0)
+	if err != nil {
+		t.Fatalf("current version: got error %v", err)
+	}
+
+	err = movies.DeleteVersion(movie.ID, movie.Version+1, 0)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("trashed movie: got error %v, want %v", err, ErrRecordNotFound)
+	}
+}
+
+func TestGetAllDidYouMean(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters MovieFilters
+		page    int
+		// whether the title search matches movies without the other filters
+		titleMatches bool
+		want         string // the text compared to titles, empty if there's no lookup
+		wantSuggest  bool
+	}{
+		{name: "first page", filters: MovieFilters{Title: `"Star Wors" -trek OR`}, page: 1, want: "star wors", wantSuggest: true},
+		{name: "past the last page", filters: MovieFilters{Title: "star wors"}, page: 2, want: ""},
+		{name: "only operators", filters: MovieFilters{Title: `-trek "`}, page: 1, want: ""},
+		{name: "no title", filters: MovieFilters{}, page: 1, want: ""},
+		{name: "misspelled with other filters", filters: MovieFilters{Title: "star wors", Genres: []string{"drama"}}, page: 1, want: "star wors", wantSuggest: true},
+		// the genre excluded the matches, the title is fine as it is
+		{name: "matching title with other filters", filters: MovieFilters{Title: "star wars", Genres: []string{"horror"}}, page: 1, titleMatches: true, want: "star wars", wantSuggest: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var compared, lookup string
+			db := sqlstub.Open(func(query string, args []driver.NamedValue) sqlstub.Result {
+				if strings.Contains(query, "title % $1") {
+					compared, lookup = args[0].Value.(string), query
+					// NOT EXISTS filters out every suggestion
+					if tt.titleMatches {
+						return sqlstub.Result{Columns: []string{"title"}}
+					}
+					return sqlstub.Result{Columns: []string{"title"}, Rows: [][]driver.Value{{"Star Wars"}}}
+				}
+				// the search matched nothing
+				return sqlstub.Result{Columns: make([]string, 10)}
+			})
+			defer db.Close()
+
+			tt.filters.GenresMode = GenresModeAll
+			filters := Filters{Page: tt.page, PageSize: 20, Sort: "id", SortSafeList: []string{"id"}}
+			_, metadata, err := MovieDAO{DB: db.DB}.GetAll(tt.filters, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if compared != tt.want {
+				t.Errorf("compared titles to %q, want %q", compared, tt.want)
+			}
+			if (metadata.DidYouMean != "") != tt.wantSuggest {
+				t.Errorf("got did_you_mean %q", metadata.DidYouMean)
+			}
+
+			// whether the title matches on its own is checked with the title alone
+			if lookup != "" {
+				_, titleOnly, _ := strings.Cut(lookup, "NOT EXISTS")
+				if !strings.Contains(titleOnly, "to_tsquery") || strings.Contains(titleOnly, "genres") {
+					t.Errorf("got lookup %s, want it to check the title without the other filters", lookup)
+				}
+			}
+		})
+	}
+}
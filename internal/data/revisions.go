@@ -0,0 +1,149 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MovieRevision is a snapshot of a movie as it was at the given version
+type MovieRevision struct {
+	MovieID   int64     `json:"movie_id"`
+	Version   int32     `json:"version"`
+	Title     string    `json:"title"`
+	Year      int32     `json:"year"`
+	Runtime   Runtime   `json:"runtime"`
+	Genres    []string  `json:"genres"`
+	UserID    *int64    `json:"user_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// DiffRevisions returns the fields which differ between two revisions
+func DiffRevisions(from, to *MovieRevision) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+
+	if from.Title != to.Title {
+		changes["title"] = FieldChange{From: from.Title, To: to.Title}
+	}
+	if from.Year != to.Year {
+		changes["year"] = FieldChange{From: from.Year, To: to.Year}
+	}
+	if from.Runtime != to.Runtime {
+		changes["runtime"] = FieldChange{From: from.Runtime, To: to.Runtime}
+	}
+	if !slices.Equal(from.Genres, to.Genres) {
+		changes["genres"] = FieldChange{From: from.Genres, To: to.Genres}
+	}
+
+	return changes
+}
+
+// insertRevision snapshots the current state of the movie, it runs in the
+// transaction which changed the movie so history can't miss a version
+func insertRevision(ctx context.Context, tx *sql.Tx, movieID, userID int64) error {
+	return insertRevisions(ctx, tx, []int64{movieID}, userID)
+}
+
+func insertRevisions(ctx context.Context, tx *sql.Tx, movieIDs []int64, userID int64) error {
+	query := `
+		INSERT INTO movie_revisions (movie_id, version, title, year, runtime, genres, user_id)
+		SELECT id, version, title, year, runtime, genres, $2
+		FROM movies
+		WHERE id = ANY($1)`
+
+	editor := sql.NullInt64{Int64: userID, Valid: userID > 0}
+
+	_, err := tx.ExecContext(ctx, query, pq.Array(movieIDs), editor)
+	return err
+}
+
+type RevisionDAO struct {
+	DB *sql.DB
+}
+
+func (dao RevisionDAO) GetAllForMovie(movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(), movie_id, version, title, year, runtime, genres, user_id, created_at
+	FROM movie_revisions
+	WHERE movie_id = $1
+	ORDER BY version DESC
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := dao.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	revisions := []*MovieRevision{}
+	var totalRecords int
+	for rows.Next() {
+		var revision MovieRevision
+		err := rows.Scan(
+			&totalRecords,
+			&revision.MovieID,
+			&revision.Version,
+			&revision.Title,
+			&revision.Year,
+			&revision.Runtime,
+			pq.Array(&revision.Genres),
+			&revision.UserID,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+func (dao RevisionDAO) Get(movieID int64, version int32) (*MovieRevision, error) {
+	query := `
+	SELECT movie_id, version, title, year, runtime, genres, user_id, created_at
+	FROM movie_revisions
+	WHERE movie_id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var revision MovieRevision
+	err := dao.DB.QueryRowContext(ctx, query, movieID, version).Scan(
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Title,
+		&revision.Year,
+		&revision.Runtime,
+		pq.Array(&revision.Genres),
+		&revision.UserID,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &revision, nil
+}
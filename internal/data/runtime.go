@@ -18,6 +18,11 @@ func (r Runtime) MarshalJSON() ([]byte, error) {
 }
 
 func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
+	// like the standard types, null leaves the value as it is
+	if string(jsonValue) == "null" {
+		return nil
+	}
+
 	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
 	if err != nil {
 		return ErrInvalidRuntimeFormat
@@ -0,0 +1,143 @@
+package data
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+)
+
+// MovieSearch tells how well a movie matched the title search
+type MovieSearch struct {
+	Rank float32 `json:"rank"`
+	// the HTML escaped title with matched words wrapped in <mark> tags,
+	// fuzzy searches don't match whole words and have none
+	Headline string `json:"headline,omitempty"`
+}
+
+// searchResult scans the columns added by MovieFilters.searchColumns
+type searchResult struct {
+	rank     sql.NullFloat64
+	headline sql.NullString
+}
+
+func (r searchResult) movieSearch() *MovieSearch {
+	if !r.rank.Valid {
+		return nil
+	}
+	return &MovieSearch{Rank: float32(r.rank.Float64), Headline: r.headline.String}
+}
+
+// searchTerm is a word or quoted phrase of a web search, or the OR between two
+type searchTerm struct {
+	words   []string
+	quoted  bool
+	negated bool
+	or      bool
+}
+
+// parseSearch splits web search syntax into terms. Only letters and digits
+// are kept in words, everything else separates them. Terms without words
+// are dropped.
+func parseSearch(s string) []searchTerm {
+	var terms []searchTerm
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		negated := false
+		if s[0] == '-' {
+			negated = true
+			s = s[1:]
+		}
+
+		var text string
+		quoted := strings.HasPrefix(s, `"`)
+		if quoted {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				text, s = s[1:], ""
+			} else {
+				text, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				end = len(s)
+			}
+			text, s = s[:end], s[end:]
+		}
+
+		if !quoted && !negated && text == "OR" {
+			terms = append(terms, searchTerm{or: true})
+			continue
+		}
+
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(words) > 0 {
+			terms = append(terms, searchTerm{words: words, quoted: quoted, negated: negated})
+		}
+	}
+
+	return terms
+}
+
+// searchQuery translates web search syntax into a to_tsquery expression:
+// words are ANDed and match as prefixes ("star" finds "Starship"), quoted
+// words match as a phrase, -word excludes and OR between terms matches either.
+// The result is always valid tsquery syntax. It returns an empty string when
+// there is nothing to search for.
+func searchQuery(s string) string {
+	var (
+		clauses [][]string // ANDed clauses of ORed alternatives
+		or      bool
+	)
+
+	for _, t := range parseSearch(s) {
+		if t.or {
+			or = len(clauses) > 0
+			continue
+		}
+
+		words := t.words
+		if !t.quoted && !t.negated {
+			for i := range words {
+				words[i] += ":*"
+			}
+		}
+
+		term := strings.Join(words, " <-> ")
+		if t.negated {
+			term = "!(" + term + ")"
+		}
+
+		if or {
+			last := len(clauses) - 1
+			clauses[last] = append(clauses[last], term)
+		} else {
+			clauses = append(clauses, []string{term})
+		}
+		or = false
+	}
+
+	parts := make([]string, len(clauses))
+	for i, alternatives := range clauses {
+		if len(alternatives) == 1 {
+			parts[i] = alternatives[0]
+		} else {
+			parts[i] = "(" + strings.Join(alternatives, " | ") + ")"
+		}
+	}
+	return strings.Join(parts, " & ")
+}
+
+// searchText returns the words a web search looks for, without operators,
+// punctuation and excluded terms
+func searchText(s string) string {
+	var words []string
+	for _, t := range parseSearch(s) {
+		if !t.or && !t.negated {
+			words = append(words, t.words...)
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "empty", input: "", want: ""},
+		{name: "words are prefixes", input: "star wars", want: "star:* & wars:*"},
+		{name: "lower case", input: "Über", want: "über:*"},
+		{name: "phrase", input: `"star wars"`, want: "star <-> wars"},
+		{name: "exclude word", input: "star -trek", want: "star:* & !(trek)"},
+		{name: "exclude phrase", input: `star -"star trek"`, want: "star:* & !(star <-> trek)"},
+		{name: "or", input: "star OR trek", want: "(star:* | trek:*)"},
+		{name: "or binds tighter than and", input: "a OR b c", want: "(a:* | b:*) & c:*"},
+		{name: "or with exclusion", input: "a OR -b", want: "(a:* | !(b))"},
+		{name: "lower case or is a word", input: "star or trek", want: "star:* & or:* & trek:*"},
+		{name: "leading or", input: "OR star", want: "star:*"},
+		{name: "trailing or", input: "star OR", want: "star:*"},
+		{name: "stray quote", input: `"star wars`, want: "star <-> wars"},
+		{name: "lone quote", input: `"`, want: ""},
+		{name: "lone dash", input: "- star", want: "star:*"},
+		{name: "punctuation only", input: `!&|():*'<->`, want: ""},
+		{name: "punctuation splits words", input: "R2-D2", want: "r2:* <-> d2:*"},
+		{name: "tsquery syntax is not passed through", input: "star:* & !wars", want: "star:* & wars:*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := searchQuery(tt.input)
+			if got != tt.want {
+				t.Errorf("searchQuery(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// the headline is rendered as HTML, it must only ever highlight an escaped title
+func TestSearchColumnsEscapeHeadline(t *testing.T) {
+	columns := MovieFilters{Title: "star"}.searchColumns(&queryArgs{})
+	if !strings.Contains(columns, "ts_headline('simple', "+htmlEscapedTitle+",") {
+		t.Errorf("headline doesn't use the escaped title: %s", columns)
+	}
+}
+
+func TestSearchText(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "", want: ""},
+		{input: "Star Wars", want: "star wars"},
+		{input: `"star wars" OR trek`, want: "star wars trek"},
+		{input: `star -"star trek" -wars`, want: "star"},
+		{input: `R2-D2: "the return`, want: "r2 d2 the return"},
+		{input: `- OR "`, want: ""},
+	}
+
+	for _, tt := range tests {
+		got := searchText(tt.input)
+		if got != tt.want {
+			t.Errorf("searchText(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type MovieStats struct {
+	Totals   StatsTotals  `json:"totals"`
+	PerYear  []YearCount  `json:"per_year"`
+	Genres   []GenreStats `json:"genres"`
+	Longest  *Movie       `json:"longest"`
+	Shortest *Movie       `json:"shortest"`
+}
+
+type StatsTotals struct {
+	Movies int `json:"movies"`
+	Genres int `json:"genres"`
+	// sum of all runtimes in minutes
+	Runtime int64 `json:"runtime"`
+}
+
+type YearCount struct {
+	Year  int32 `json:"year"`
+	Count int   `json:"count"`
+}
+
+// GenreStats describes the movies of a genre, runtimes are in minutes
+type GenreStats struct {
+	Genre          string  `json:"genre"`
+	Count          int     `json:"count"`
+	AverageRuntime float64 `json:"average_runtime"`
+	MedianRuntime  float64 `json:"median_runtime"`
+}
+
+type StatsDAO struct {
+	DB *sql.DB
+}
+
+// GetMovieStats aggregates the movies matching the filters. All queries run
+// in one snapshot, so the numbers agree with each other.
+func (dao StatsDAO) GetMovieStats(movieFilters MovieFilters) (*MovieStats, error) {
+	args := queryArgs{}
+	where := movieFilters.where(&args)
+
+	// aggregates read every matching movie, give them more time than a lookup
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := dao.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stats := &MovieStats{PerYear: []YearCount{}, Genres: []GenreStats{}}
+
+	query := `
+	SELECT count(*), coalesce(sum(runtime), 0)
+	FROM movies
+	WHERE ` + where
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&stats.Totals.Movies, &stats.Totals.Runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT year, count(*)
+	FROM movies
+	WHERE ` + where + `
+	GROUP BY year
+	ORDER BY year`
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var year YearCount
+		err := rows.Scan(&year.Year, &year.Count)
+		if err != nil {
+			return nil, err
+		}
+		stats.PerYear = append(stats.PerYear, year)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT genre, count(*),
+		round(avg(runtime), 1)::float8,
+		percentile_cont(0.5) WITHIN GROUP (ORDER BY runtime)
+	FROM movies, unnest(genres) AS genre
+	WHERE ` + where + `
+	GROUP BY genre
+	ORDER BY count(*) DESC, genre`
+
+	rows, err = tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var genre GenreStats
+		err := rows.Scan(&genre.Genre, &genre.Count, &genre.AverageRuntime, &genre.MedianRuntime)
+		if err != nil {
+			return nil, err
+		}
+		stats.Genres = append(stats.Genres, genre)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	stats.Totals.Genres = len(stats.Genres)
+
+	stats.Longest, err = statsMovie(ctx, tx, where, "runtime DESC, id ASC", args)
+	if err != nil {
+		return nil, err
+	}
+	stats.Shortest, err = statsMovie(ctx, tx, where, "runtime ASC, id ASC", args)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, tx.Commit()
+}
+
+// statsMovie returns the first matching movie in the given order, nil if none match
+func statsMovie(ctx context.Context, tx *sql.Tx, where, orderBy string, args queryArgs) (*Movie, error) {
+	query := `
+	SELECT id, created_at, title, year, runtime, genres, version
+	FROM movies
+	WHERE ` + where + `
+	ORDER BY ` + orderBy + `
+	LIMIT 1`
+
+	var movie Movie
+	err := tx.QueryRowContext(ctx, query, args...).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return &movie, nil
+}
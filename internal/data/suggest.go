@@ -0,0 +1,73 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MovieSuggestion is a title offered while the user is still typing
+type MovieSuggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Year  int32  `json:"year"`
+}
+
+// likeEscaper makes the user's input match literally in a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Suggest returns up to limit movies whose titles start with prefix, ignoring
+// case. They are in byte order of the lowercased title, so a title comes right
+// before the longer ones it is a prefix of. A query that runs out of time
+// returns an error wrapping context.DeadlineExceeded.
+func (dao MovieDAO) Suggest(prefix string, limit int) ([]*MovieSuggestion, error) {
+	// (lower(title) text_pattern_ops, id) is indexed, see migration 000010.
+	// ~<~ is the order of that operator class, so the index scan serves the
+	// filter and the order and stops after limit rows.
+	query := `
+	SELECT id, title, year
+	FROM movies
+	WHERE lower(title) LIKE $1 AND deleted_at IS NULL
+	ORDER BY lower(title) USING ~<~, id
+	LIMIT $2`
+
+	pattern := likeEscaper.Replace(strings.ToLower(prefix)) + "%"
+
+	// suggestions are only useful while the user is typing
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	rows, err := dao.DB.QueryContext(ctx, query, pattern, limit)
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+	defer rows.Close()
+
+	suggestions := []*MovieSuggestion{}
+	for rows.Next() {
+		var suggestion MovieSuggestion
+		err := rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Year)
+		if err != nil {
+			return nil, timeoutError(ctx, err)
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+
+	return suggestions, nil
+}
+
+// timeoutError makes err match the context's error once ctx is done. lib/pq
+// cancels the query on the server and reports that as a query_canceled error
+// (57014) rather than the context's error.
+func timeoutError(ctx context.Context, err error) error {
+	if ctx.Err() == nil || errors.Is(err, ctx.Err()) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ctx.Err(), err)
+}
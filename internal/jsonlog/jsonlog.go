@@ -3,6 +3,7 @@ package jsonlog
 import (
 	"encoding/json"
 	"io"
+	"os"
 	"runtime/debug"
 	"sync"
 	"time"
@@ -51,8 +52,10 @@ func (l *Logger) PrintError(message string, properties map[string]string) {
 	l.print(LevelError, message, properties)
 }
 
+// PrintFatal logs the error and exits, deferred functions don't run
 func (l *Logger) PrintFatal(err error, properties map[string]string) {
 	l.print(LevelFatal, err.Error(), properties)
+	os.Exit(1)
 }
 
 func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
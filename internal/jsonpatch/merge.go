@@ -0,0 +1,72 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON values.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrMalformedPatch   = errors.New("malformed patch")
+	ErrInvalidOperation = errors.New("patch can't be applied")
+	ErrTestFailed       = errors.New("patch test operation failed")
+)
+
+// MergePatch applies an RFC 7396 merge patch to doc. Objects are merged
+// recursively, null removes a member, anything else replaces the target.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	err := decode(doc, &target)
+	if err != nil {
+		return nil, err
+	}
+
+	var p interface{}
+	err = decode(patch, &p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedPatch, err)
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+// decode keeps numbers as json.Number, so they are written back unchanged
+func decode(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	err := dec.Decode(v)
+	if err != nil {
+		return err
+	}
+
+	if dec.More() {
+		return errors.New("must only contain a single JSON value")
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "replace member",
+			doc:   movieDoc,
+			patch: `{"title":"Moana 2"}`,
+			want:  `{"title":"Moana 2","year":2016,"runtime":107,"genres":["animation","adventure"]}`,
+		},
+		{
+			name:  "null removes member",
+			doc:   movieDoc,
+			patch: `{"genres":null}`,
+			want:  `{"title":"Moana","year":2016,"runtime":107}`,
+		},
+		{
+			name:  "null for a missing member",
+			doc:   `{"a":1}`,
+			patch: `{"b":null}`,
+			want:  `{"a":1}`,
+		},
+		{
+			name:  "arrays are replaced",
+			doc:   movieDoc,
+			patch: `{"genres":["musical"]}`,
+			want:  `{"title":"Moana","year":2016,"runtime":107,"genres":["musical"]}`,
+		},
+		{
+			name:  "objects are merged",
+			doc:   `{"a":{"b":1,"c":2}}`,
+			patch: `{"a":{"b":null,"d":3}}`,
+			want:  `{"a":{"c":2,"d":3}}`,
+		},
+		{
+			name:  "non-object patch replaces the document",
+			doc:   movieDoc,
+			patch: `["a"]`,
+			want:  `["a"]`,
+		},
+		{
+			name:  "numbers keep their digits",
+			doc:   `{"id":12345678901234567890}`,
+			patch: `{}`,
+			want:  `{"id":12345678901234567890}`,
+		},
+		{
+			name:    "malformed patch",
+			doc:     movieDoc,
+			patch:   `{"title":`,
+			wantErr: ErrMalformedPatch,
+		},
+		{
+			name:    "trailing data",
+			doc:     movieDoc,
+			patch:   `{} {}`,
+			wantErr: ErrMalformedPatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
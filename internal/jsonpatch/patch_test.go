@@ -0,0 +1,185 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const movieDoc = `{"title":"Moana","year":2016,"runtime":107,"genres":["animation","adventure"]}`
+
+// assertJSON compares documents by value, so key order doesn't matter. Numbers
+// are compared as written, which catches precision lost on the way through.
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+
+	var g, w interface{}
+	if err := decode(got, &g); err != nil {
+		t.Fatalf("invalid result %s: %v", got, err)
+	}
+	if err := decode([]byte(want), &w); err != nil {
+		t.Fatalf("invalid expectation %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "add appends with -",
+			doc:   movieDoc,
+			patch: `[{"op":"add","path":"/genres/-","value":"comedy"}]`,
+			want:  `{"title":"Moana","year":2016,"runtime":107,"genres":["animation","adventure","comedy"]}`,
+		},
+		{
+			name:  "add inserts at index",
+			doc:   movieDoc,
+			patch: `[{"op":"add","path":"/genres/0","value":"comedy"}]`,
+			want:  `{"title":"Moana","year":2016,"runtime":107,"genres":["comedy","animation","adventure"]}`,
+		},
+		{
+			name:    "add past the end",
+			doc:     movieDoc,
+			patch:   `[{"op":"add","path":"/genres/3","value":"comedy"}]`,
+			wantErr: ErrInvalidOperation,
+		},
+		{
+			name:  "add keeps null",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"add","path":"/b","value":null}]`,
+			want:  `{"a":1,"b":null}`,
+		},
+		{
+			name:  "replace",
+			doc:   movieDoc,
+			patch: `[{"op":"replace","path":"/title","value":"Moana 2"},{"op":"replace","path":"/genres/1","value":"musical"}]`,
+			want:  `{"title":"Moana 2","year":2016,"runtime":107,"genres":["animation","musical"]}`,
+		},
+		{
+			name:  "replace the root",
+			doc:   movieDoc,
+			patch: `[{"op":"replace","path":"","value":{"title":"Up"}},{"op":"add","path":"/year","value":2009}]`,
+			want:  `{"title":"Up","year":2009}`,
+		},
+		{
+			name:    "remove the root",
+			doc:     movieDoc,
+			patch:   `[{"op":"remove","path":""}]`,
+			wantErr: ErrInvalidOperation,
+		},
+		{
+			name:    "replace missing member",
+			doc:     movieDoc,
+			patch:   `[{"op":"replace","path":"/director","value":"Ron Clements"}]`,
+			wantErr: ErrInvalidOperation,
+		},
+		{
+			name:  "remove array element",
+			doc:   movieDoc,
+			patch: `[{"op":"remove","path":"/genres/0"}]`,
+			want:  `{"title":"Moana","year":2016,"runtime":107,"genres":["adventure"]}`,
+		},
+		{
+			name:  "test passes",
+			doc:   movieDoc,
+			patch: `[{"op":"test","path":"/runtime","value":107.0},{"op":"replace","path":"/runtime","value":108}]`,
+			want:  `{"title":"Moana","year":2016,"runtime":108,"genres":["animation","adventure"]}`,
+		},
+		{
+			name:    "test fails",
+			doc:     movieDoc,
+			patch:   `[{"op":"replace","path":"/title","value":"Moana 2"},{"op":"test","path":"/year","value":2024}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:  "move",
+			doc:   `{"a":{"b":1},"c":{}}`,
+			patch: `[{"op":"move","from":"/a/b","path":"/c/b"}]`,
+			want:  `{"a":{},"c":{"b":1}}`,
+		},
+		{
+			name:    "move into itself",
+			doc:     `{"a":{"b":1}}`,
+			patch:   `[{"op":"move","from":"/a","path":"/a/b/c"}]`,
+			wantErr: ErrInvalidOperation,
+		},
+		{
+			name:  "move to a sibling sharing the prefix",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"move","from":"/a","path":"/ab"}]`,
+			want:  `{"ab":1}`,
+		},
+		{
+			name:  "copy is independent of the source",
+			doc:   `{"a":[1]}`,
+			patch: `[{"op":"copy","from":"/a","path":"/b"},{"op":"add","path":"/b/-","value":2}]`,
+			want:  `{"a":[1],"b":[1,2]}`,
+		},
+		{
+			name:  "escaped pointer",
+			doc:   `{"a/b":1,"c~d":2}`,
+			patch: `[{"op":"remove","path":"/a~1b"},{"op":"remove","path":"/c~0d"}]`,
+			want:  `{}`,
+		},
+		{
+			name:    "leading zero index",
+			doc:     movieDoc,
+			patch:   `[{"op":"remove","path":"/genres/01"}]`,
+			wantErr: ErrInvalidOperation,
+		},
+		{
+			name:    "not an array",
+			doc:     movieDoc,
+			patch:   `{"op":"remove","path":"/title"}`,
+			wantErr: ErrMalformedPatch,
+		},
+		{
+			name:    "null",
+			doc:     movieDoc,
+			patch:   `null`,
+			wantErr: ErrMalformedPatch,
+		},
+		{
+			name:  "empty",
+			doc:   movieDoc,
+			patch: `[]`,
+			want:  movieDoc,
+		},
+		{
+			name:    "missing value",
+			doc:     movieDoc,
+			patch:   `[{"op":"add","path":"/title"}]`,
+			wantErr: ErrMalformedPatch,
+		},
+		{
+			name:    "unknown op",
+			doc:     movieDoc,
+			patch:   `[{"op":"rename","path":"/title"}]`,
+			wantErr: ErrMalformedPatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"net/mail"
+	"text/template"
+	"time"
+)
+
+// templates define "subject", "plainBody" and "htmlBody" blocks
+//
+//go:embed "templates"
+var templateFS embed.FS
+
+const sendAttempts = 3
+
+// retryDelay is the pause between attempts, a variable so tests don't wait
+var retryDelay = 500 * time.Millisecond
+
+// Transport delivers an already rendered message
+type Transport interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+type Mailer struct {
+	transport Transport
+	sender    string
+}
+
+func New(transport Transport, sender string) Mailer {
+	return Mailer{
+		transport: transport,
+		sender:    sender,
+	}
+}
+
+func (m Mailer) Send(recipient, templateFile string, data interface{}) error {
+	textTmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+
+	subject := new(bytes.Buffer)
+	err = textTmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = textTmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return err
+	}
+
+	// html/template escapes data, so the html part is rendered separately
+	htmlTmpl, err := htmltemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return err
+	}
+
+	msg := &message{
+		from:      m.sender,
+		to:        recipient,
+		subject:   subject.String(),
+		plainBody: plainBody.String(),
+		htmlBody:  htmlBody.String(),
+		date:      time.Now(),
+	}
+	raw, err := msg.bytes()
+	if err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.sender)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return err
+	}
+
+	// smtp servers fail intermittently, so try a few times before giving up
+	for i := 1; ; i++ {
+		err = m.transport.Send(from.Address, []string{to.Address}, raw)
+		if err == nil || i == sendAttempts {
+			return err
+		}
+		time.Sleep(retryDelay)
+	}
+}
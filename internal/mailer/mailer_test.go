@@ -0,0 +1,146 @@
+package mailer
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	transport := &MemoryTransport{}
+	m := New(transport, "Greenlight <no-reply@greenlight.test>")
+
+	data := map[string]interface{}{
+		"userID":          42,
+		"activationToken": "<b>TOKEN</b>",
+	}
+	err := m.Send("alice@example.com", "user_welcome.tmpl", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := transport.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	sent := messages[0]
+	if sent.From != "no-reply@greenlight.test" {
+		t.Errorf("got envelope sender %q", sent.From)
+	}
+	if len(sent.To) != 1 || sent.To[0] != "alice@example.com" {
+		t.Errorf("got envelope recipients %q", sent.To)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(sent.Data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Welcome to Greenlight!" {
+		t.Errorf("got subject %q, %v", subject, err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("got content type %q, %v", mediaType, err)
+	}
+
+	// the reader undoes the quoted-printable encoding of each part
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	wants := []struct {
+		contentType string
+		contains    []string
+	}{
+		{"text/plain; charset=UTF-8", []string{"your user ID number is 42", `{"token": "<b>TOKEN</b>"}`}},
+		{"text/html; charset=UTF-8", []string{"your user ID number is 42", `&lt;b&gt;TOKEN&lt;/b&gt;`}},
+	}
+	for _, want := range wants {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("%s part: %v", want.contentType, err)
+		}
+		if got := part.Header.Get("Content-Type"); got != want.contentType {
+			t.Errorf("got part content type %q, want %q", got, want.contentType)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range want.contains {
+			if !strings.Contains(string(body), s) {
+				t.Errorf("%s part doesn't contain %q:\n%s", want.contentType, s, body)
+			}
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("got more than two parts, %v", err)
+	}
+}
+
+// flakyTransport fails the given number of times before it succeeds
+type flakyTransport struct {
+	failures int
+	calls    int
+}
+
+func (t *flakyTransport) Send(from string, to []string, msg []byte) error {
+	t.calls++
+	if t.calls <= t.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestSendRetries(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	tests := []struct {
+		name      string
+		failures  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "first attempt", failures: 0, wantCalls: 1},
+		{name: "last attempt", failures: sendAttempts - 1, wantCalls: sendAttempts},
+		{name: "every attempt fails", failures: sendAttempts + 1, wantCalls: sendAttempts, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &flakyTransport{failures: tt.failures}
+			m := New(transport, "no-reply@greenlight.test")
+
+			data := map[string]interface{}{"passwordResetToken": "TOKEN"}
+			err := m.Send("alice@example.com", "token_password_reset.tmpl", data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if transport.calls != tt.wantCalls {
+				t.Errorf("got %d attempts, want %d", transport.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// no pause follows the final attempt, the error is returned right away
+func TestSendNoDelayAfterLastAttempt(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 200 * time.Millisecond
+
+	m := New(&flakyTransport{failures: sendAttempts}, "no-reply@greenlight.test")
+
+	start := time.Now()
+	err := m.Send("alice@example.com", "token_password_reset.tmpl", map[string]interface{}{"passwordResetToken": "TOKEN"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed >= sendAttempts*retryDelay {
+		t.Errorf("took %s, want less than %s", elapsed, sendAttempts*retryDelay)
+	}
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"time"
+)
+
+type message struct {
+	from      string
+	to        string
+	subject   string
+	plainBody string
+	htmlBody  string
+	date      time.Time
+}
+
+// bytes renders the message as multipart/alternative with plain and html parts
+func (m *message) bytes() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+
+	fmt.Fprintf(buf, "From: %s\r\n", m.from)
+	fmt.Fprintf(buf, "To: %s\r\n", m.to)
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", m.date.Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n", mw.Boundary())
+	fmt.Fprintf(buf, "\r\n")
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", m.plainBody},
+		{"text/html; charset=UTF-8", m.htmlBody},
+	}
+
+	for _, part := range parts {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(pw)
+		_, err = qw.Write([]byte(part.body))
+		if err != nil {
+			return nil, err
+		}
+		err = qw.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
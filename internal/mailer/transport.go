@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type SMTPTransport struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+func (t SMTPTransport) Send(from string, to []string, msg []byte) error {
+	var auth smtp.Auth
+	if t.Username != "" {
+		auth = smtp.PlainAuth("", t.Username, t.Password, t.Host)
+	}
+
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	return smtp.SendMail(addr, auth, from, to, msg)
+}
+
+// FileTransport writes every message into Dir as an .eml file,
+// which is handy in development when there is no smtp server around
+type FileTransport struct {
+	Dir string
+}
+
+func (t FileTransport) Send(from string, to []string, msg []byte) error {
+	err := os.MkdirAll(t.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.eml", time.Now().UnixNano())
+	return os.WriteFile(filepath.Join(t.Dir, name), msg, 0o644)
+}
+
+type Message struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// MemoryTransport keeps sent messages so they can be inspected later
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (t *MemoryTransport) Send(from string, to []string, msg []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = append(t.messages, Message{From: from, To: to, Data: msg})
+	return nil
+}
+
+func (t *MemoryTransport) Messages() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	messages := make([]Message, len(t.messages))
+	copy(messages, t.messages)
+	return messages
+}
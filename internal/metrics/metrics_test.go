@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, r *Registry) string {
+	t.Helper()
+
+	var b strings.Builder
+	err := r.Write(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(r *Registry)
+		want  string
+	}{
+		{
+			name: "counter",
+			setup: func(r *Registry) {
+				c := r.NewCounterVec("requests_total", "Requests served.", "method", "status")
+				c.Inc("POST", "201")
+				c.Inc("GET", "200")
+				c.Add(2.5, "GET", "200")
+			},
+			// series are sorted by their label values
+			want: `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{method="GET",status="200"} 3.5
+requests_total{method="POST",status="201"} 1
+`,
+		},
+		{
+			name: "counter without series",
+			setup: func(r *Registry) {
+				r.NewCounterVec("errors_total", "Errors.", "kind")
+			},
+			want: `# HELP errors_total Errors.
+# TYPE errors_total counter
+`,
+		},
+		{
+			name: "counter without labels",
+			setup: func(r *Registry) {
+				r.NewCounterVec("panics_total", "Panics.").Inc()
+			},
+			want: `# HELP panics_total Panics.
+# TYPE panics_total counter
+panics_total 1
+`,
+		},
+		{
+			name: "escaping",
+			setup: func(r *Registry) {
+				c := r.NewCounterVec("odd_total", "Help with a \\ backslash\nand a newline.", "value")
+				c.Inc("quote \" backslash \\ newline \n end")
+			},
+			want: `# HELP odd_total Help with a \\ backslash\nand a newline.
+# TYPE odd_total counter
+odd_total{value="quote \" backslash \\ newline \n end"} 1
+`,
+		},
+		{
+			name: "gauge and counter funcs",
+			setup: func(r *Registry) {
+				r.NewGaugeFunc("open_connections", "Open connections.", func() float64 { return 7 })
+				r.NewCounterFunc("wait_seconds_total", "Time spent waiting.", func() float64 { return 0.25 })
+				r.NewGaugeFunc("unbounded", "Special values.", func() float64 { return math.Inf(1) })
+			},
+			// families come in the order they were registered
+			want: `# HELP open_connections Open connections.
+# TYPE open_connections gauge
+open_connections 7
+# HELP wait_seconds_total Time spent waiting.
+# TYPE wait_seconds_total counter
+wait_seconds_total 0.25
+# HELP unbounded Special values.
+# TYPE unbounded gauge
+unbounded +Inf
+`,
+		},
+		{
+			name: "histogram",
+			setup: func(r *Registry) {
+				h := r.NewHistogramVec("duration_seconds", "Durations.", []float64{0.1, 1}, "route")
+				h.Observe(0.05, "/b")
+				h.Observe(0.1, "/a")
+				h.Observe(0.5, "/a")
+				h.Observe(3, "/a")
+			},
+			// buckets are cumulative and the value on a bound falls into it
+			want: `# HELP duration_seconds Durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/a",le="0.1"} 1
+duration_seconds_bucket{route="/a",le="1"} 2
+duration_seconds_bucket{route="/a",le="+Inf"} 3
+duration_seconds_sum{route="/a"} 3.6
+duration_seconds_count{route="/a"} 3
+duration_seconds_bucket{route="/b",le="0.1"} 1
+duration_seconds_bucket{route="/b",le="1"} 1
+duration_seconds_bucket{route="/b",le="+Inf"} 1
+duration_seconds_sum{route="/b"} 0.05
+duration_seconds_count{route="/b"} 1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			tt.setup(r)
+
+			got := render(t, r)
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeFunc("up", "Up.", func() float64 { return 1 })
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if got := w.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("got content type %q", got)
+	}
+	if got, want := w.Body.String(), "# HELP up Up.\n# TYPE up gauge\nup 1\n"; got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+}
+
+func TestPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(r *Registry)
+	}{
+		{
+			name: "duplicate name",
+			fn: func(r *Registry) {
+				r.NewGaugeFunc("up", "Up.", func() float64 { return 1 })
+				r.NewCounterVec("up", "Up again.")
+			},
+		},
+		{
+			name: "wrong number of label values",
+			fn: func(r *Registry) {
+				r.NewCounterVec("requests_total", "Requests.", "method", "status").Inc("GET")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			tt.fn(NewRegistry())
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// memStats caches runtime.MemStats for a second, reading them stops the world
+type memStats struct {
+	mu      sync.Mutex
+	stats   runtime.MemStats
+	updated time.Time
+}
+
+func (m *memStats) get() runtime.MemStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Since(m.updated) > time.Second {
+		runtime.ReadMemStats(&m.stats)
+		m.updated = time.Now()
+	}
+	return m.stats
+}
+
+// RegisterRuntimeMetrics adds the usual go_* metrics about the current process
+func (r *Registry) RegisterRuntimeMetrics() {
+	ms := &memStats{}
+
+	r.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	r.NewGaugeFunc("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", func() float64 {
+		return float64(ms.get().Alloc)
+	})
+	r.NewGaugeFunc("go_memstats_sys_bytes", "Number of bytes obtained from system.", func() float64 {
+		return float64(ms.get().Sys)
+	})
+	r.NewGaugeFunc("go_memstats_heap_objects", "Number of allocated objects.", func() float64 {
+		return float64(ms.get().HeapObjects)
+	})
+	r.NewCounterFunc("go_gc_cycles_total", "Number of completed GC cycles.", func() float64 {
+		return float64(ms.get().NumGC)
+	})
+	r.NewCounterFunc("go_gc_pause_seconds_total", "Total time spent in GC stop-the-world pauses.", func() float64 {
+		return time.Duration(ms.get().PauseTotalNs).Seconds()
+	})
+}
@@ -0,0 +1,331 @@
+// Package migrate applies the numbered sql migrations and keeps track of
+// the current schema version in the schema_migrations table. The table
+// layout is the same golang-migrate uses, so databases migrated with that
+// tool can be managed here too.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrDirty          = errors.New("database schema is dirty")
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+// arbitrary key, the same for every process that migrates this database
+const advisoryLockID = 7_361_142_806
+
+var fileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		matches := fileRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has files with different names", version)
+		}
+
+		// 1_x.up.sql and 01_x.up.sql are the same version
+		if matches[3] == "up" {
+			if migration.Up != "" {
+				return nil, fmt.Errorf("migration %d has more than one up file", version)
+			}
+			migration.Up = string(body)
+		} else {
+			if migration.Down != "" {
+				return nil, fmt.Errorf("migration %d has more than one down file", version)
+			}
+			migration.Down = string(body)
+		}
+	}
+
+	m := &Migrator{db: db}
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", migration.Version)
+		}
+		m.migrations = append(m.migrations, *migration)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+
+	return m, nil
+}
+
+// Latest returns the version of the newest known migration
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the applied version, 0 means no migrations were applied
+func (m *Migrator) Version(ctx context.Context) (int64, bool, error) {
+	var exists bool
+	err := m.db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil || !exists {
+		return 0, false, err
+	}
+
+	return readVersion(ctx, m.db)
+}
+
+// Up applies the next n migrations, or all pending ones when n <= 0
+func (m *Migrator) Up(ctx context.Context, n int) error {
+	return m.withLock(ctx, func(conn *sql.Conn, current int64) error {
+		pending := m.migrations[m.index(current)+1:]
+		if n > 0 && n < len(pending) {
+			pending = pending[:n]
+		}
+
+		for _, migration := range pending {
+			err := m.apply(ctx, conn, migration.Version, migration.Up)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last n migrations, or all of them when n <= 0
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	if n <= 0 {
+		n = len(m.migrations)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn, current int64) error {
+		for i := m.index(current); i >= 0 && n > 0; i-- {
+			err := m.revert(ctx, conn, i)
+			if err != nil {
+				return err
+			}
+			n--
+		}
+		return nil
+	})
+}
+
+// Goto migrates up or down until the schema is at the given version
+func (m *Migrator) Goto(ctx context.Context, version int64) error {
+	if version != 0 && !m.known(version) {
+		return ErrUnknownVersion
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn, current int64) error {
+		for i := m.index(current) + 1; i < len(m.migrations) && m.migrations[i].Version <= version; i++ {
+			err := m.apply(ctx, conn, m.migrations[i].Version, m.migrations[i].Up)
+			if err != nil {
+				return err
+			}
+		}
+		for i := m.index(current); i >= 0 && m.migrations[i].Version > version; i-- {
+			err := m.revert(ctx, conn, i)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Force records the version as applied and clean without running any sql,
+// it is the way out after a failed migration was fixed by hand
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 && !m.known(version) {
+		return ErrUnknownVersion
+	}
+
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.unlock(conn)
+
+	return setVersion(ctx, conn, version, false)
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, current int64) error) error {
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.unlock(conn)
+
+	current, dirty, err := readVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w at version %d", ErrDirty, current)
+	}
+	if current != 0 && !m.known(current) {
+		return fmt.Errorf("%w %d applied to the database", ErrUnknownVersion, current)
+	}
+
+	return fn(conn, current)
+}
+
+// lock pins a connection, since advisory locks belong to a session
+func (m *Migrator) lock(ctx context.Context) (*sql.Conn, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockID)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	_, err = conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint NOT NULL PRIMARY KEY,
+		dirty boolean NOT NULL
+	)`)
+	if err != nil {
+		m.unlock(conn)
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (m *Migrator) unlock(conn *sql.Conn) {
+	// the lock is released with the session anyway if this fails
+	conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockID)
+	conn.Close()
+}
+
+// apply marks the target version dirty, runs the sql and marks it clean,
+// so a failure in the middle of a file is visible in schema_migrations
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, target int64, statements string) error {
+	err := setVersion(ctx, conn, target, true)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, statements)
+	if err != nil {
+		return fmt.Errorf("migration to version %d failed: %w", target, err)
+	}
+
+	return setVersion(ctx, conn, target, false)
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, i int) error {
+	var target int64
+	if i > 0 {
+		target = m.migrations[i-1].Version
+	}
+
+	if m.migrations[i].Down == "" {
+		return fmt.Errorf("migration %d has no down file", m.migrations[i].Version)
+	}
+
+	return m.apply(ctx, conn, target, m.migrations[i].Down)
+}
+
+// index returns the position of the version in m.migrations, -1 for version 0
+func (m *Migrator) index(version int64) int {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Migrator) known(version int64) bool {
+	return m.index(version) >= 0
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func readVersion(ctx context.Context, q queryer) (int64, bool, error) {
+	var version int64
+	var dirty bool
+
+	err := q.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+	return version, dirty, nil
+}
+
+func setVersion(ctx context.Context, conn *sql.Conn, version int64, dirty bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+
+	// a dirty 0 is kept too, it means reverting the first migration failed
+	if version > 0 || dirty {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`, version, dirty)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
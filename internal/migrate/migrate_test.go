@@ -0,0 +1,318 @@
+package migrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"greenlight.vysotsky.com/internal/sqlstub"
+)
+
+func TestNew(t *testing.T) {
+	file := func(body string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(body)} }
+
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		versions []int64
+		wantErr  string
+	}{
+		{
+			name: "sorted by version",
+			fsys: fstest.MapFS{
+				"10_c.up.sql":   file("c"),
+				"2_b.up.sql":    file("b"),
+				"2_b.down.sql":  file("-b"),
+				"001_a.up.sql":  file("a"),
+				"migrations.go": file("package migrations"),
+				"README.md":     file("docs"),
+			},
+			versions: []int64{1, 2, 10},
+		},
+		{
+			name:     "empty",
+			fsys:     fstest.MapFS{},
+			versions: nil,
+		},
+		{
+			name:    "names differ",
+			fsys:    fstest.MapFS{"1_a.up.sql": file("a"), "1_b.down.sql": file("-b")},
+			wantErr: "different names",
+		},
+		{
+			name:    "down without up",
+			fsys:    fstest.MapFS{"1_a.down.sql": file("-a")},
+			wantErr: "no up file",
+		},
+		{
+			name:    "duplicate up",
+			fsys:    fstest.MapFS{"1_a.up.sql": file("a"), "01_a.up.sql": file("a")},
+			wantErr: "more than one up file",
+		},
+		{
+			name:    "duplicate down",
+			fsys:    fstest.MapFS{"1_a.up.sql": file("a"), "1_a.down.sql": file("-a"), "001_a.down.sql": file("-a")},
+			wantErr: "more than one down file",
+		},
+		{
+			name:    "version 0",
+			fsys:    fstest.MapFS{"0_a.up.sql": file("a")},
+			wantErr: "invalid migration version",
+		},
+		{
+			name:     "not a migration name",
+			fsys:     fstest.MapFS{"a_1.up.sql": file("a"), "1-a.up.sql": file("a"), "1_a.sql": file("a")},
+			versions: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New(nil, tt.fsys)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var versions []int64
+			for _, migration := range m.migrations {
+				versions = append(versions, migration.Version)
+			}
+			if !reflect.DeepEqual(versions, tt.versions) {
+				t.Errorf("got versions %v, want %v", versions, tt.versions)
+			}
+		})
+	}
+}
+
+// fakeSchema plays the database side of a migration: it keeps the
+// schema_migrations row and logs the migration sql it runs
+type fakeSchema struct {
+	mu      sync.Mutex
+	version int64
+	dirty   bool
+	exists  bool
+	ran     []string
+	// sql containing this fails
+	fail string
+}
+
+func (s *fakeSchema) handle(query string, args []driver.NamedValue) sqlstub.Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.Contains(query, "pg_advisory"), strings.Contains(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+		return sqlstub.Result{Columns: []string{"lock"}, Rows: [][]driver.Value{{""}}}
+	case strings.Contains(query, "SELECT version, dirty FROM schema_migrations"):
+		if !s.exists {
+			return sqlstub.Result{Columns: []string{"version", "dirty"}}
+		}
+		return sqlstub.Result{Columns: []string{"version", "dirty"}, Rows: [][]driver.Value{{s.version, s.dirty}}}
+	case strings.Contains(query, "DELETE FROM schema_migrations"):
+		s.version, s.dirty, s.exists = 0, false, false
+		return sqlstub.Result{}
+	case strings.Contains(query, "INSERT INTO schema_migrations"):
+		s.version, s.dirty, s.exists = args[0].Value.(int64), args[1].Value.(bool), true
+		return sqlstub.Result{RowsAffected: 1}
+	}
+
+	if s.fail != "" && strings.Contains(query, s.fail) {
+		return sqlstub.Result{Err: errors.New("syntax error")}
+	}
+	s.ran = append(s.ran, query)
+	return sqlstub.Result{}
+}
+
+var testMigrations = fstest.MapFS{
+	"1_a.up.sql":   {Data: []byte("up 1")},
+	"1_a.down.sql": {Data: []byte("down 1")},
+	"2_b.up.sql":   {Data: []byte("up 2")},
+	"2_b.down.sql": {Data: []byte("down 2")},
+	// versions don't have to be consecutive
+	"5_c.up.sql":   {Data: []byte("up 5")},
+	"5_c.down.sql": {Data: []byte("down 5")},
+}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		name        string
+		from        int64
+		run         func(ctx context.Context, m *Migrator) error
+		wantVersion int64
+		wantRan     []string
+	}{
+		{
+			name:        "up all",
+			run:         func(ctx context.Context, m *Migrator) error { return m.Up(ctx, 0) },
+			wantVersion: 5,
+			wantRan:     []string{"up 1", "up 2", "up 5"},
+		},
+		{
+			name:        "up n",
+			from:        1,
+			run:         func(ctx context.Context, m *Migrator) error { return m.Up(ctx, 1) },
+			wantVersion: 2,
+			wantRan:     []string{"up 2"},
+		},
+		{
+			name:        "up more than pending",
+			from:        2,
+			run:         func(ctx context.Context, m *Migrator) error { return m.Up(ctx, 10) },
+			wantVersion: 5,
+			wantRan:     []string{"up 5"},
+		},
+		{
+			name:        "up to date",
+			from:        5,
+			run:         func(ctx context.Context, m *Migrator) error { return m.Up(ctx, 0) },
+			wantVersion: 5,
+		},
+		{
+			name:        "down n",
+			from:        5,
+			run:         func(ctx context.Context, m *Migrator) error { return m.Down(ctx, 2) },
+			wantVersion: 1,
+			wantRan:     []string{"down 5", "down 2"},
+		},
+		{
+			name:        "down all",
+			from:        5,
+			run:         func(ctx context.Context, m *Migrator) error { return m.Down(ctx, 0) },
+			wantVersion: 0,
+			wantRan:     []string{"down 5", "down 2", "down 1"},
+		},
+		{
+			name:        "goto up",
+			from:        1,
+			run:         func(ctx context.Context, m *Migrator) error { return m.Goto(ctx, 5) },
+			wantVersion: 5,
+			wantRan:     []string{"up 2", "up 5"},
+		},
+		{
+			name:        "goto down",
+			from:        5,
+			run:         func(ctx context.Context, m *Migrator) error { return m.Goto(ctx, 1) },
+			wantVersion: 1,
+			wantRan:     []string{"down 5", "down 2"},
+		},
+		{
+			name:        "goto 0",
+			from:        2,
+			run:         func(ctx context.Context, m *Migrator) error { return m.Goto(ctx, 0) },
+			wantVersion: 0,
+			wantRan:     []string{"down 2", "down 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := &fakeSchema{version: tt.from, exists: tt.from > 0}
+			db := sqlstub.Open(schema.handle)
+			defer db.Close()
+
+			m, err := New(db.DB, testMigrations)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = tt.run(context.Background(), m)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if schema.version != tt.wantVersion {
+				t.Errorf("got version %d, want %d", schema.version, tt.wantVersion)
+			}
+			if schema.dirty {
+				t.Error("schema left dirty")
+			}
+			if !reflect.DeepEqual(schema.ran, tt.wantRan) {
+				t.Errorf("ran %q, want %q", schema.ran, tt.wantRan)
+			}
+		})
+	}
+}
+
+func TestWalkErrors(t *testing.T) {
+	t.Run("unknown version", func(t *testing.T) {
+		schema := &fakeSchema{}
+		db := sqlstub.Open(schema.handle)
+		defer db.Close()
+		m, _ := New(db.DB, testMigrations)
+
+		// 3 falls into the gap between 2 and 5
+		for _, err := range []error{m.Goto(context.Background(), 3), m.Force(context.Background(), 3)} {
+			if !errors.Is(err, ErrUnknownVersion) {
+				t.Errorf("got error %v, want %v", err, ErrUnknownVersion)
+			}
+		}
+	})
+
+	t.Run("dirty", func(t *testing.T) {
+		schema := &fakeSchema{version: 2, dirty: true, exists: true}
+		db := sqlstub.Open(schema.handle)
+		defer db.Close()
+		m, _ := New(db.DB, testMigrations)
+
+		err := m.Up(context.Background(), 0)
+		if !errors.Is(err, ErrDirty) {
+			t.Errorf("got error %v, want %v", err, ErrDirty)
+		}
+		if len(schema.ran) != 0 {
+			t.Errorf("ran %q on a dirty schema", schema.ran)
+		}
+	})
+
+	t.Run("failed migration stays dirty", func(t *testing.T) {
+		schema := &fakeSchema{version: 1, exists: true, fail: "up 5"}
+		db := sqlstub.Open(schema.handle)
+		defer db.Close()
+		m, _ := New(db.DB, testMigrations)
+
+		err := m.Up(context.Background(), 0)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if schema.version != 5 || !schema.dirty {
+			t.Errorf("got version %d dirty %t, want 5 dirty", schema.version, schema.dirty)
+		}
+	})
+
+	t.Run("force clears dirty", func(t *testing.T) {
+		schema := &fakeSchema{version: 5, dirty: true, exists: true}
+		db := sqlstub.Open(schema.handle)
+		defer db.Close()
+		m, _ := New(db.DB, testMigrations)
+
+		err := m.Force(context.Background(), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schema.version != 2 || schema.dirty || len(schema.ran) != 0 {
+			t.Errorf("got version %d dirty %t ran %q, want clean 2 without running sql", schema.version, schema.dirty, schema.ran)
+		}
+	})
+
+	t.Run("missing down file", func(t *testing.T) {
+		schema := &fakeSchema{version: 1, exists: true}
+		db := sqlstub.Open(schema.handle)
+		defer db.Close()
+		m, _ := New(db.DB, fstest.MapFS{"1_a.up.sql": {Data: []byte("up 1")}})
+
+		err := m.Down(context.Background(), 0)
+		if err == nil || !strings.Contains(err.Error(), "no down file") {
+			t.Errorf("got error %v, want a missing down file", err)
+		}
+	})
+}
@@ -1,5 +1,5 @@
-alter table movies drop constraint if exists movies_runtime_check
+alter table movies drop constraint if exists movies_runtime_check;
 
-alter table movies drop constraint if exists movies_year_check 
+alter table movies drop constraint if exists movies_year_check;
 
-alter table movies drop constraint if exists genres_length_check 
\ No newline at end of file
+alter table movies drop constraint if exists genres_length_check;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS movies_title_prefix_idx ON movies (lower(title) text_pattern_ops, id) WHERE deleted_at IS NULL;
@@ -0,0 +1,8 @@
+// Package migrations embeds the sql migration files so binaries don't
+// depend on the working directory they are started from.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS